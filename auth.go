@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errInvalidCredentials = errors.New("invalid username or password")
+	errAccountExists      = errors.New("account already exists")
+	errTokenRequired      = errors.New("token required")
+	errUnknownClient      = errors.New("invalid token")
+	errTokenRevoked       = errors.New("token revoked")
+	errTicketUsed         = errors.New("ticket already used")
+	errTicketOnly         = errors.New("connect tickets only open WebSockets")
+	errWrongPurpose       = errors.New("token can't be used here")
+	errForbidden          = errors.New("forbidden")
+)
+
+const (
+	// ticketTTL is how long a WebSocket connect ticket stays usable. It
+	// only has to outlive the round trip between fetching it and
+	// connecting.
+	ticketTTL = 30 * time.Second
+	// resumeTTL is how long a customer can come back to a conversation
+	// after losing their page.
+	resumeTTL = 24 * time.Hour
+)
+
+// Account is a staff login. Accounts come from ACCOUNTS_FILE or are
+// created by an admin with POST /accounts and saved in the store. The
+// profile fields seed the agent's Client on first login.
+type Account struct {
+	Username     string   `json:"username"`
+	PasswordHash string   `json:"password_hash"`
+	Role         Role     `json:"role"`
+	Name         string   `json:"name"`
+	Language     string   `json:"language"`
+	Languages    []string `json:"languages,omitempty"`
+	Skills       []string `json:"skills,omitempty"`
+	MaxRooms     int      `json:"max_rooms,omitempty"`
+}
+
+// passwordIterations is the PBKDF2-SHA256 work factor for new hashes.
+// Stored hashes carry their own count, so raising it doesn't break logins.
+const passwordIterations = 600_000
+
+// hashPassword returns "pbkdf2-sha256$<iterations>$<salt>$<key>".
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkPassword reports whether password matches a hash from hashPassword.
+func checkPassword(hash string, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// loadAccountsFile reads a JSON array of accounts with hashed passwords.
+func loadAccountsFile(path string) ([]Account, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []Account
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return accounts, nil
+}
+
+// Authenticator checks staff credentials and issues and verifies signed,
+// expiring tokens. Every instance behind a load balancer must share the
+// same secret.
+type Authenticator struct {
+	secret []byte
+	ttl    time.Duration
+	store  Store
+
+	mu       sync.Mutex
+	accounts map[string]Account
+}
+
+// NewAuthenticator loads the accounts saved in store. seed accounts (from
+// ACCOUNTS_FILE) are added on top without being written back.
+func NewAuthenticator(secret []byte, ttl time.Duration, store Store, seed []Account) (*Authenticator, error) {
+	a := &Authenticator{
+		secret:   secret,
+		ttl:      ttl,
+		store:    store,
+		accounts: make(map[string]Account),
+	}
+	saved, err := store.LoadAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("loading accounts: %w", err)
+	}
+	for _, account := range append(saved, seed...) {
+		a.accounts[account.Username] = account
+	}
+	slog.Info("accounts loaded", "count", len(a.accounts))
+	return a, nil
+}
+
+// CreateAccount hashes password and saves a new account.
+func (a *Authenticator) CreateAccount(account Account, password string) (Account, error) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return account, err
+	}
+	account.PasswordHash = hash
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.accounts[account.Username]; ok {
+		return account, errAccountExists
+	}
+	if err := a.store.SaveAccount(account); err != nil {
+		return account, err
+	}
+	a.accounts[account.Username] = account
+	return account, nil
+}
+
+// Login checks a username and password.
+func (a *Authenticator) Login(username string, password string) (Account, error) {
+	a.mu.Lock()
+	account, ok := a.accounts[username]
+	a.mu.Unlock()
+	if !ok || !checkPassword(account.PasswordHash, password) {
+		return Account{}, errInvalidCredentials
+	}
+	return account, nil
+}
+
+// Issue signs a token for client carrying its role, starting a new
+// session.
+func (a *Authenticator) Issue(client *Client) (string, time.Time, error) {
+	return a.sign(client, generateToken())
+}
+
+// Refresh signs a fresh token in the same session as claims, picking up
+// any role change. Logging out revokes the whole session, so refreshed
+// tokens die with the original.
+func (a *Authenticator) Refresh(client *Client, claims Claims) (string, time.Time, error) {
+	return a.sign(client, claims.Session)
+}
+
+// IssueTicket signs a single-use WebSocket connect ticket in the same
+// session as claims. Tickets expire within seconds, so unlike tokens they
+// are safe to put in a URL.
+func (a *Authenticator) IssueTicket(client *Client, claims Claims) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(ticketTTL)
+	ticket, err := signToken(a.secret, Claims{
+		Subject:   client.Token,
+		Role:      client.Role,
+		Session:   claims.Session,
+		Purpose:   purposeTicket,
+		ID:        generateToken(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	return ticket, expires, err
+}
+
+// IssueCustomer starts a customer's session, signing a bearer token and
+// a resume token in it. The resume token outlives the bearer token so the
+// customer can get back into their conversation after losing their page;
+// it is only accepted by POST /resume and dies with the session.
+func (a *Authenticator) IssueCustomer(client *Client) (token string, resumeToken string, expires time.Time, err error) {
+	session := generateToken()
+	token, expires, err = a.sign(client, session)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	now := time.Now()
+	resumeToken, err = signToken(a.secret, Claims{
+		Subject:   client.Token,
+		Role:      client.Role,
+		Session:   session,
+		Purpose:   purposeResume,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(resumeTTL).Unix(),
+	})
+	return token, resumeToken, expires, err
+}
+
+// Resume checks a resume token and signs a fresh bearer token in its
+// session.
+func (a *Authenticator) Resume(hub *Hub, resumeToken string) (*Client, string, time.Time, error) {
+	claims, err := a.Verify(resumeToken)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	if claims.Purpose != purposeResume {
+		return nil, "", time.Time{}, errWrongPurpose
+	}
+	if hub.IsRevoked(claims.Session) {
+		return nil, "", time.Time{}, errTokenRevoked
+	}
+	client, ok := hub.GetClient(claims.Subject)
+	if !ok {
+		return nil, "", time.Time{}, errUnknownClient
+	}
+	hub.Touch(client)
+	token, expires, err := a.sign(client, claims.Session)
+	return client, token, expires, err
+}
+
+func (a *Authenticator) sign(client *Client, session string) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(a.ttl)
+	token, err := signToken(a.secret, Claims{
+		Subject:   client.Token,
+		Role:      client.Role,
+		Session:   session,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	return token, expires, err
+}
+
+// Logout revokes the session claims belongs to. The revocation is kept
+// until every token in the session has expired, including a customer's
+// resume token, which can outlive their bearer tokens.
+func (a *Authenticator) Logout(hub *Hub, claims Claims) {
+	hub.RevokeSession(claims.Session, time.Now().Add(max(a.ttl, resumeTTL)))
+}
+
+// Verify checks a token's signature and expiry.
+func (a *Authenticator) Verify(token string) (Claims, error) {
+	return parseToken(a.secret, token, time.Now())
+}
+
+type clientKey struct{}
+
+type claimsKey struct{}
+
+// requestClient returns the client Require authenticated.
+func requestClient(r *http.Request) *Client {
+	client, _ := r.Context().Value(clientKey{}).(*Client)
+	return client
+}
+
+// requestClaims returns the verified claims of the request's token.
+func requestClaims(r *http.Request) Claims {
+	claims, _ := r.Context().Value(claimsKey{}).(Claims)
+	return claims
+}
+
+// bearerToken reads the token from the Authorization header.
+func bearerToken(r *http.Request) string {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token
+}
+
+// authenticate checks a bearer token, or with allowTicket also a connect
+// ticket, and that its role is at least minRole. A ticket is spent here.
+func (a *Authenticator) authenticate(hub *Hub, credential string, minRole Role, allowTicket bool) (*Client, Claims, error) {
+	if credential == "" {
+		return nil, Claims{}, errTokenRequired
+	}
+	claims, err := a.Verify(credential)
+	if err != nil {
+		return nil, claims, err
+	}
+	if hub.IsRevoked(claims.Session) {
+		return nil, claims, errTokenRevoked
+	}
+	client, ok := hub.GetClient(claims.Subject)
+	if !ok {
+		return nil, claims, errUnknownClient
+	}
+	if !claims.Role.AtLeast(minRole) {
+		return nil, claims, errForbidden
+	}
+	switch claims.Purpose {
+	case "":
+	case purposeTicket:
+		if !allowTicket {
+			return nil, claims, errTicketOnly
+		}
+		if !hub.ConsumeTicket(claims.ID, time.Unix(claims.ExpiresAt, 0)) {
+			return nil, claims, errTicketUsed
+		}
+	default:
+		return nil, claims, errWrongPurpose
+	}
+	hub.Touch(client)
+	return client, claims, nil
+}
+
+// authStatus maps an authenticate error to an HTTP status.
+func authStatus(err error) int {
+	if errors.Is(err, errForbidden) {
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
+
+// Require wraps next so it only runs for a valid token whose role is at
+// least minRole. The caller's Client is available via requestClient.
+func (a *Authenticator) Require(hub *Hub, minRole Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, claims, err := a.authenticate(hub, bearerToken(r), minRole, false)
+		if err != nil {
+			http.Error(w, err.Error(), authStatus(err))
+			return
+		}
+		ctx := context.WithValue(r.Context(), clientKey{}, client)
+		next(w, r.WithContext(context.WithValue(ctx, claimsKey{}, claims)))
+	}
+}
+
+// AccountClient returns the client for a staff account, creating it from
+// the account's profile on first login. Later logins reuse the client so
+// its rooms and profile edits carry over.
+func (h *Hub) AccountClient(account Account, defaultMaxRooms int) *Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, client := range h.Clients {
+		if client.Account == account.Username {
+			if client.Role != account.Role {
+				client.Role = account.Role
+				h.saveClient(client)
+			}
+			return client
+		}
+	}
+
+	client := NewClient(account.Name, account.Language)
+	client.Role = account.Role
+	client.Account = account.Username
+	client.Languages = account.Languages
+	client.Skills = account.Skills
+	client.MaxRooms = account.MaxRooms
+	if client.MaxRooms <= 0 {
+		client.MaxRooms = defaultMaxRooms
+	}
+	client.lastSeen = time.Now()
+	client.owner = h.instanceID
+	h.Clients[client.Token] = client
+	h.saveClient(client)
+	slog.Info("staff client created", "account", account.Username, "role", account.Role)
+	return client
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAuth signs the tokens tests pass to handlers behind Require.
+var testAuth = &Authenticator{
+	secret:   []byte("test-secret"),
+	ttl:      time.Hour,
+	store:    NewMemoryStore(),
+	accounts: make(map[string]Account),
+}
+
+func signedToken(t *testing.T, client *Client) string {
+	t.Helper()
+	token, _, err := testAuth.Issue(client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return token
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Now()
+	token, err := signToken(secret, Claims{Subject: "abc", Role: RoleAgent, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	claims, err := parseToken(secret, token, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Subject != "abc" || claims.Role != RoleAgent {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	if _, err := parseToken([]byte("other"), token, now); !errors.Is(err, errBadSignature) {
+		t.Errorf("expected bad signature with another secret, got %v", err)
+	}
+	if _, err := parseToken(secret, token, now.Add(2*time.Hour)); !errors.Is(err, errTokenExpired) {
+		t.Errorf("expected expired token, got %v", err)
+	}
+
+	// Swapping in a payload that claims admin must break the signature.
+	parts := strings.Split(token, ".")
+	forged, _ := signToken([]byte("attacker"), Claims{Subject: "abc", Role: RoleAdmin, ExpiresAt: now.Add(time.Hour).Unix()})
+	parts[1] = strings.Split(forged, ".")[1]
+	if _, err := parseToken(secret, strings.Join(parts, "."), now); !errors.Is(err, errBadSignature) {
+		t.Errorf("expected forged payload to be rejected, got %v", err)
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	hash, err := hashPassword("hunter2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !checkPassword(hash, "hunter2") {
+		t.Error("expected password to match its hash")
+	}
+	if checkPassword(hash, "hunter3") {
+		t.Error("expected wrong password to be rejected")
+	}
+	if checkPassword("plaintext", "plaintext") {
+		t.Error("expected unhashed value to be rejected")
+	}
+}
+
+func TestRequireEnforcesRole(t *testing.T) {
+	hub := newTestHub(t)
+	customer := NewClient("Alice", "pt")
+	customer.Role = RoleCustomer
+	agent := NewClient("Bob", "en")
+	agent.Role = RoleAgent
+	hub.AddClient(customer)
+	hub.AddClient(agent)
+
+	var seen *Client
+	handler := testAuth.Require(hub, RoleAgent, func(w http.ResponseWriter, r *http.Request) {
+		seen = requestClient(r)
+	})
+	status := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/rooms", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	if code := status(""); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", code)
+	}
+	if code := status(customer.Token); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a raw client token, got %d", code)
+	}
+	if code := status(signedToken(t, customer)); code != http.StatusForbidden {
+		t.Errorf("expected 403 for a customer, got %d", code)
+	}
+	if code := status(signedToken(t, agent)); code != http.StatusOK || seen != agent {
+		t.Errorf("expected agent to pass, got %d", code)
+	}
+}
+
+func TestLoginIssuesRoleToken(t *testing.T) {
+	hub := newTestHub(t)
+	store := NewMemoryStore()
+	auth, err := NewAuthenticator([]byte("secret"), time.Hour, store, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := auth.CreateAccount(Account{Username: "lea", Role: RoleSupervisor, Name: "Lea", Language: "en"}, "s3cret"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	login := handleLogin(hub, auth, 3)
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		login(rec, httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(body)))
+		return rec
+	}
+
+	if rec := post(`{"username":"lea","password":"wrong"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong password, got %d", rec.Code)
+	}
+
+	rec := post(`{"username":"lea","password":"s3cret"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp LoginResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	claims, err := auth.Verify(resp.Token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Role != RoleSupervisor || resp.Role != RoleSupervisor {
+		t.Errorf("expected supervisor role, got %s / %s", claims.Role, resp.Role)
+	}
+
+	// Logging in again reuses the same client, and the account survives a
+	// restart through the store.
+	again := post(`{"username":"lea","password":"s3cret"}`)
+	var second LoginResponse
+	json.NewDecoder(again.Body).Decode(&second)
+	if c, _ := auth.Verify(second.Token); c.Subject != claims.Subject {
+		t.Error("expected second login to reuse the client")
+	}
+	restarted, err := NewAuthenticator([]byte("secret"), time.Hour, store, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := restarted.Login("lea", "s3cret"); err != nil {
+		t.Errorf("expected saved account to log in after restart, got %v", err)
+	}
+}
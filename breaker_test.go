@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	breaker := NewCircuitBreaker(2, time.Minute)
+
+	breaker.Failure()
+	if breaker.State() != BreakerClosed {
+		t.Fatalf("expected closed after 1 failure, got %s", breaker.State())
+	}
+	breaker.Failure()
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("expected open after 2 failures, got %s", breaker.State())
+	}
+	if breaker.Allow() {
+		t.Fatal("expected open breaker to reject calls")
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	breaker := NewCircuitBreaker(1, 20*time.Millisecond)
+	breaker.Failure()
+
+	time.Sleep(30 * time.Millisecond)
+
+	if !breaker.Allow() {
+		t.Fatal("expected a probe after cooldown")
+	}
+	if breaker.Allow() {
+		t.Fatal("expected only one probe while half-open")
+	}
+	breaker.Success()
+	if breaker.State() != BreakerClosed {
+		t.Errorf("expected closed after successful probe, got %s", breaker.State())
+	}
+}
+
+func TestBreakerFailedProbeReopens(t *testing.T) {
+	breaker := NewCircuitBreaker(3, 20*time.Millisecond)
+	breaker.Failure()
+	breaker.Failure()
+	breaker.Failure()
+
+	time.Sleep(30 * time.Millisecond)
+	breaker.Allow()
+	breaker.Failure()
+
+	if breaker.State() != BreakerOpen {
+		t.Errorf("expected open after failed probe, got %s", breaker.State())
+	}
+}
+
+func TestProviderChainFailsOver(t *testing.T) {
+	primary := NewFakeProvider()
+	primary.Err = errors.New("down")
+	secondary := NewFakeProvider()
+	chain := NewProviderChain([]TranslationProvider{primary, secondary}, 1, time.Minute, time.Second)
+
+	got, err := chain.Translate(context.Background(), "hola", "es", "en")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "[en] hola" {
+		t.Errorf("expected [en] hola, got %s", got)
+	}
+
+	// The primary's breaker is open now, so it should be skipped entirely.
+	chain.Translate(context.Background(), "adios", "es", "en")
+	if primary.Calls() != 1 {
+		t.Errorf("expected primary to be called once, got %d", primary.Calls())
+	}
+	if chain.Status()[0].State != BreakerOpen {
+		t.Errorf("expected primary breaker open, got %s", chain.Status()[0].State)
+	}
+}
+
+func TestProviderChainAllDown(t *testing.T) {
+	primary := NewFakeProvider()
+	primary.Err = errors.New("down")
+	chain := NewProviderChain([]TranslationProvider{primary}, 1, time.Minute, time.Second)
+
+	chain.Translate(context.Background(), "hola", "es", "en")
+	_, err := chain.Translate(context.Background(), "hola", "es", "en")
+	if !errors.Is(err, errAllProvidersUnavailable) {
+		t.Fatalf("expected errAllProvidersUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// Bus is a topic-based pub/sub transport between server instances.
+// Handlers for one subscription are called in publish order, one at a
+// time, and never on the publisher's goroutine.
+type Bus interface {
+	Publish(ctx context.Context, topic string, data []byte) error
+	Subscribe(topic string, handler func(data []byte)) (unsubscribe func(), err error)
+	Close() error
+}
+
+// LocalBus delivers messages within a single process. It's the default
+// when no external bus is configured, and lets tests run several hubs
+// side by side as if they were separate instances.
+type LocalBus struct {
+	mu     sync.Mutex
+	subs   map[string]map[int]*localSubscription
+	nextID int
+}
+
+func NewLocalBus() *LocalBus {
+	return &LocalBus{subs: make(map[string]map[int]*localSubscription)}
+}
+
+func (b *LocalBus) Publish(ctx context.Context, topic string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, sub := range b.subs[topic] {
+		sub.push(append([]byte(nil), data...))
+	}
+	return nil
+}
+
+func (b *LocalBus) Subscribe(topic string, handler func(data []byte)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := newLocalSubscription(handler)
+	id := b.nextID
+	b.nextID++
+	if b.subs[topic] == nil {
+		b.subs[topic] = make(map[int]*localSubscription)
+	}
+	b.subs[topic][id] = sub
+
+	return func() {
+		b.mu.Lock()
+		delete(b.subs[topic], id)
+		if len(b.subs[topic]) == 0 {
+			delete(b.subs, topic)
+		}
+		b.mu.Unlock()
+		sub.stop()
+	}, nil
+}
+
+func (b *LocalBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, subs := range b.subs {
+		for _, sub := range subs {
+			sub.stop()
+		}
+	}
+	b.subs = make(map[string]map[int]*localSubscription)
+	return nil
+}
+
+// localSubscription queues messages without bound and hands them to the
+// handler from its own goroutine, so a publisher holding a lock can never
+// deadlock against a subscriber that needs the same lock.
+type localSubscription struct {
+	mu      sync.Mutex
+	queue   [][]byte
+	wake    chan struct{}
+	done    chan struct{}
+	handler func(data []byte)
+	once    sync.Once
+}
+
+func newLocalSubscription(handler func(data []byte)) *localSubscription {
+	sub := &localSubscription{
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		handler: handler,
+	}
+	go sub.run()
+	return sub
+}
+
+func (s *localSubscription) push(data []byte) {
+	s.mu.Lock()
+	s.queue = append(s.queue, data)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *localSubscription) run() {
+	for {
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			data := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			s.handler(data)
+		}
+	}
+}
+
+func (s *localSubscription) stop() {
+	s.once.Do(func() { close(s.done) })
+}
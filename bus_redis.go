@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RedisBus is a Bus backed by Redis PUBLISH/SUBSCRIBE. It speaks RESP
+// directly over two TCP connections, one for publishing and one held in
+// subscribe mode, and reconnects the subscriber if it drops.
+type RedisBus struct {
+	addr string
+
+	pubMu   sync.Mutex
+	pubConn net.Conn
+	pubR    *bufio.Reader
+
+	mu       sync.Mutex
+	subConn  net.Conn
+	handlers map[string]map[int]*localSubscription
+	nextID   int
+	closed   bool
+}
+
+func NewRedisBus(addr string) (*RedisBus, error) {
+	b := &RedisBus{
+		addr:     addr,
+		handlers: make(map[string]map[int]*localSubscription),
+	}
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	b.subConn = conn
+	go b.readLoop(conn)
+	return b, nil
+}
+
+func writeCommand(w io.Writer, args ...string) error {
+	buf := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, arg := range args {
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// readValue reads one RESP value. Arrays come back as []any, bulk strings
+// as []byte, integers as int64 and simple strings as string.
+func readValue(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("redis: short reply %q", line)
+	}
+	body := line[1 : len(line)-2]
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]any, 0, max(n, 0))
+		for i := 0; i < n; i++ {
+			v, err := readValue(r)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+func (b *RedisBus) Publish(ctx context.Context, topic string, data []byte) error {
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+
+	if b.pubConn == nil {
+		d := net.Dialer{Timeout: 5 * time.Second}
+		conn, err := d.DialContext(ctx, "tcp", b.addr)
+		if err != nil {
+			return err
+		}
+		b.pubConn = conn
+		b.pubR = bufio.NewReader(conn)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		b.pubConn.SetDeadline(deadline)
+	} else {
+		b.pubConn.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+
+	err := writeCommand(b.pubConn, "PUBLISH", topic, string(data))
+	if err == nil {
+		_, err = readValue(b.pubR)
+	}
+	if err != nil {
+		// Drop the connection so the next publish redials.
+		b.pubConn.Close()
+		b.pubConn = nil
+	}
+	return err
+}
+
+func (b *RedisBus) Subscribe(topic string, handler func(data []byte)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, errors.New("redis bus is closed")
+	}
+
+	if len(b.handlers[topic]) == 0 {
+		if err := writeCommand(b.subConn, "SUBSCRIBE", topic); err != nil {
+			return nil, err
+		}
+		b.handlers[topic] = make(map[int]*localSubscription)
+	}
+	id := b.nextID
+	b.nextID++
+	sub := newLocalSubscription(handler)
+	b.handlers[topic][id] = sub
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		sub.stop()
+		delete(b.handlers[topic], id)
+		if len(b.handlers[topic]) == 0 {
+			delete(b.handlers, topic)
+			if !b.closed {
+				writeCommand(b.subConn, "UNSUBSCRIBE", topic)
+			}
+		}
+	}, nil
+}
+
+func (b *RedisBus) readLoop(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		v, err := readValue(r)
+		if err != nil {
+			b.mu.Lock()
+			closed := b.closed
+			b.mu.Unlock()
+			if closed {
+				return
+			}
+			slog.Error("redis bus subscriber disconnected", "error", err)
+			b.reconnect()
+			return
+		}
+		msg, ok := v.([]any)
+		if !ok || len(msg) != 3 {
+			continue
+		}
+		kind, _ := msg[0].([]byte)
+		if string(kind) != "message" {
+			continue
+		}
+		topic, _ := msg[1].([]byte)
+		data, _ := msg[2].([]byte)
+
+		b.mu.Lock()
+		for _, sub := range b.handlers[string(topic)] {
+			sub.push(data)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// reconnect redials with backoff and resubscribes every active topic.
+func (b *RedisBus) reconnect() {
+	backoff := 100 * time.Millisecond
+	for {
+		conn, err := net.DialTimeout("tcp", b.addr, 5*time.Second)
+		if err == nil {
+			b.mu.Lock()
+			if b.closed {
+				b.mu.Unlock()
+				conn.Close()
+				return
+			}
+			b.subConn = conn
+			for topic := range b.handlers {
+				writeCommand(conn, "SUBSCRIBE", topic)
+			}
+			b.mu.Unlock()
+			slog.Info("redis bus subscriber reconnected")
+			go b.readLoop(conn)
+			return
+		}
+		time.Sleep(backoff)
+		backoff = min(backoff*2, 5*time.Second)
+
+		b.mu.Lock()
+		closed := b.closed
+		b.mu.Unlock()
+		if closed {
+			return
+		}
+	}
+}
+
+func (b *RedisBus) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	for _, subs := range b.handlers {
+		for _, sub := range subs {
+			sub.stop()
+		}
+	}
+	err := b.subConn.Close()
+	b.mu.Unlock()
+
+	b.pubMu.Lock()
+	if b.pubConn != nil {
+		b.pubConn.Close()
+	}
+	b.pubMu.Unlock()
+	return err
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// fakeRedis is a stand-in for a Redis server that only understands
+// SUBSCRIBE, UNSUBSCRIBE and PUBLISH.
+type fakeRedis struct {
+	ln   net.Listener
+	mu   sync.Mutex // guards subs and serializes writes to any conn
+	subs map[string]map[net.Conn]bool
+}
+
+func startFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r := &fakeRedis{ln: ln, subs: make(map[string]map[net.Conn]bool)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return r
+}
+
+func (r *fakeRedis) Addr() string {
+	return r.ln.Addr().String()
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		v, err := readValue(reader)
+		if err != nil {
+			r.mu.Lock()
+			for _, conns := range r.subs {
+				delete(conns, conn)
+			}
+			r.mu.Unlock()
+			return
+		}
+		args, _ := v.([]any)
+		if len(args) < 2 {
+			continue
+		}
+		cmd, _ := args[0].([]byte)
+		topic, _ := args[1].([]byte)
+		switch strings.ToUpper(string(cmd)) {
+		case "SUBSCRIBE":
+			r.mu.Lock()
+			if r.subs[string(topic)] == nil {
+				r.subs[string(topic)] = make(map[net.Conn]bool)
+			}
+			r.subs[string(topic)][conn] = true
+			writeCommand(conn, "subscribe", string(topic), "1")
+			r.mu.Unlock()
+		case "UNSUBSCRIBE":
+			r.mu.Lock()
+			delete(r.subs[string(topic)], conn)
+			r.mu.Unlock()
+		case "PUBLISH":
+			payload, _ := args[2].([]byte)
+			r.mu.Lock()
+			n := 0
+			for sub := range r.subs[string(topic)] {
+				writeCommand(sub, "message", string(topic), string(payload))
+				n++
+			}
+			conn.Write([]byte(":" + strconv.Itoa(n) + "\r\n"))
+			r.mu.Unlock()
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLocalBusPreservesOrder(t *testing.T) {
+	bus := NewLocalBus()
+	defer bus.Close()
+
+	var mu sync.Mutex
+	var got []string
+	bus.Subscribe("t", func(data []byte) {
+		mu.Lock()
+		got = append(got, string(data))
+		mu.Unlock()
+	})
+	for _, s := range []string{"a", "b", "c"} {
+		bus.Publish(context.Background(), "t", []byte(s))
+	}
+
+	waitFor(t, "3 messages", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 3
+	})
+	if strings.Join(got, "") != "abc" {
+		t.Errorf("expected abc, got %v", got)
+	}
+}
+
+func TestRedisBusPublishSubscribe(t *testing.T) {
+	redis := startFakeRedis(t)
+	bus, err := NewRedisBus(redis.Addr())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bus.Close()
+
+	received := make(chan string, 1)
+	bus.Subscribe("room:1", func(data []byte) { received <- string(data) })
+	// Give the stand-in a moment to register the subscription.
+	waitFor(t, "subscription", func() bool {
+		redis.mu.Lock()
+		defer redis.mu.Unlock()
+		return len(redis.subs["room:1"]) == 1
+	})
+
+	if err := bus.Publish(context.Background(), "room:1", []byte("hello")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case got := <-received:
+		if got != "hello" {
+			t.Errorf("expected hello, got %s", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+}
+
+func TestHubsReplicateOverBus(t *testing.T) {
+	bus := NewLocalBus()
+	defer bus.Close()
+	hubA, _ := NewHub(NewMemoryStore(), bus)
+	hubB, _ := NewHub(NewMemoryStore(), bus)
+
+	customer := NewClient("Alice", "pt")
+	hubA.AddClient(customer)
+	room := hubA.CreateRoom(customer, "")
+
+	waitFor(t, "room on instance B", func() bool {
+		_, ok := hubB.GetRoom(room.ID)
+		return ok
+	})
+
+	agent := NewClient("Bob", "en")
+	hubB.AddClient(agent)
+	if _, err := hubB.JoinRoom(room.ID, agent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	waitFor(t, "agent on instance A", func() bool {
+		got, _ := hubA.GetRoom(room.ID)
+		hubA.mu.Lock()
+		defer hubA.mu.Unlock()
+		return got.Status == RoomActive && got.Agent != nil && got.Agent.Token == agent.Token
+	})
+}
+
+// stalledBus is a LocalBus whose publishes hang until released, like a
+// Redis instance that stopped answering.
+type stalledBus struct {
+	*LocalBus
+	release chan struct{}
+}
+
+func (b *stalledBus) Publish(ctx context.Context, topic string, data []byte) error {
+	<-b.release
+	return b.LocalBus.Publish(ctx, topic, data)
+}
+
+func TestStalledBusDoesNotBlockHub(t *testing.T) {
+	bus := &stalledBus{LocalBus: NewLocalBus(), release: make(chan struct{})}
+	defer bus.Close()
+	hub, err := NewHub(NewMemoryStore(), bus)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer close(bus.release)
+
+	done := make(chan struct{})
+	go func() {
+		customer := NewClient("Alice", "pt")
+		hub.AddClient(customer)
+		hub.CreateRoom(customer, "")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected hub changes to go ahead while the bus is stalled")
+	}
+}
+
+func TestCrossInstanceMessageDelivery(t *testing.T) {
+	redis := startFakeRedis(t)
+	newInstance := func() (*Hub, *httptest.Server) {
+		bus, err := NewRedisBus(redis.Addr())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		t.Cleanup(func() { bus.Close() })
+		hub, err := NewHub(NewMemoryStore(), bus)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		translator := NewTranslator(NewFakeProvider(), NewTranslationCache(CacheOptions{TTL: time.Minute}))
+		mux := http.NewServeMux()
+		mux.HandleFunc("/ws", handleWebSocket(hub, NewPipeline(hub, translator), NewRateLimiter(100, time.Minute), NewSocketAuth(testAuth, hub, nil)))
+		srv := httptest.NewServer(mux)
+		t.Cleanup(srv.Close)
+		return hub, srv
+	}
+	hubA, srvA := newInstance()
+	hubB, srvB := newInstance()
+	waitFor(t, "both instances subscribed", func() bool {
+		redis.mu.Lock()
+		defer redis.mu.Unlock()
+		return len(redis.subs[hubTopic]) == 2
+	})
+
+	customer := NewClient("Alice", "pt")
+	customer.Role = RoleCustomer
+	hubA.AddClient(customer)
+	room := hubA.CreateRoom(customer, "")
+	agent := NewClient("Bob", "en")
+	agent.Role = RoleAgent
+	waitFor(t, "room on instance B", func() bool {
+		_, ok := hubB.GetRoom(room.ID)
+		return ok
+	})
+	hubB.AddClient(agent)
+	hubB.JoinRoom(room.ID, agent)
+	waitFor(t, "agent on instance A", func() bool {
+		hubA.mu.Lock()
+		defer hubA.mu.Unlock()
+		return hubA.Rooms[room.ID].Agent != nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dial := func(srv *httptest.Server, client *Client) (*websocket.Conn, *http.Response, error) {
+		return websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws?room_id="+room.ID, &websocket.DialOptions{
+			Subprotocols: []string{socketProtocol, authProtocolPrefix + signedToken(t, client)},
+		})
+	}
+	customerConn, _, err := dial(srvA, customer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer customerConn.CloseNow()
+	agentConn, _, err := dial(srvB, agent)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer agentConn.CloseNow()
+
+	waitFor(t, "agent presence on instance A", func() bool {
+		hubA.mu.Lock()
+		defer hubA.mu.Unlock()
+		return hubA.Clients[agent.Token].Online
+	})
+
+	customerConn.Write(ctx, websocket.MessageText, []byte(`{"content":"Olá"}`))
+
+	_, data, err := agentConn.Read(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var msg ChatMessage
+	json.Unmarshal(data, &msg)
+	if msg.Content != "Olá" || msg.TranslatedContent != "[en] Olá" {
+		t.Errorf("expected translated message, got %+v", msg)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"container/list"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	text      string
+	createdAt time.Time
+}
+
+// CacheStore persists cache entries so they survive a restart. The
+// in-memory LRU is always the source of truth; the store is written
+// through and only read at startup.
+type CacheStore interface {
+	Load(fn func(key string, entry cacheEntry)) error
+	Put(key string, entry cacheEntry) error
+	Delete(key string) error
+	Close() error
+}
+
+// CacheStats are the cache counters reported by /health.
+type CacheStats struct {
+	Entries     int   `json:"entries"`
+	Bytes       int   `json:"bytes"`
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	Evictions   int64 `json:"evictions"`
+	Expirations int64 `json:"expirations"`
+}
+
+type CacheOptions struct {
+	TTL          time.Duration
+	MaxEntries   int
+	MaxBytes     int
+	JanitorEvery time.Duration
+	Store        CacheStore
+}
+
+type lruItem struct {
+	key   string
+	entry cacheEntry
+}
+
+// TranslationCache is a size-bounded LRU cache with TTL expiry. Expired
+// entries are dropped on read and by a background janitor.
+type TranslationCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	maxBytes   int
+	items      map[string]*list.Element
+	order      *list.List // front is most recently used
+	bytes      int
+	stats      CacheStats
+	store      CacheStore
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+func NewTranslationCache(opts CacheOptions) *TranslationCache {
+	c := &TranslationCache{
+		ttl:        opts.TTL,
+		maxEntries: opts.MaxEntries,
+		maxBytes:   opts.MaxBytes,
+		items:      make(map[string]*list.Element),
+		order:      list.New(),
+		store:      opts.Store,
+		stop:       make(chan struct{}),
+	}
+
+	if c.store != nil {
+		err := c.store.Load(func(key string, entry cacheEntry) {
+			if c.expired(entry) {
+				c.store.Delete(key)
+				return
+			}
+			c.insert(key, entry)
+		})
+		if err != nil {
+			slog.Error("failed to load translation cache", "error", err)
+		}
+		slog.Info("translation cache loaded", "entries", len(c.items))
+	}
+
+	if opts.JanitorEvery > 0 {
+		go c.janitor(opts.JanitorEvery)
+	}
+	return c
+}
+
+func entrySize(key string, entry cacheEntry) int {
+	return len(key) + len(entry.text)
+}
+
+func (c *TranslationCache) expired(entry cacheEntry) bool {
+	return c.ttl > 0 && time.Since(entry.createdAt) > c.ttl
+}
+
+func (c *TranslationCache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return "", false
+	}
+	item := el.Value.(*lruItem)
+	if c.expired(item.entry) {
+		c.remove(el)
+		c.stats.Expirations++
+		c.stats.Misses++
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	c.stats.Hits++
+	return item.entry.text, true
+}
+
+func (c *TranslationCache) Set(key string, text string) {
+	entry := cacheEntry{text: text, createdAt: time.Now()}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	c.insert(key, entry)
+	if c.store != nil {
+		if err := c.store.Put(key, entry); err != nil {
+			slog.Error("failed to persist cache entry", "error", err)
+		}
+	}
+}
+
+// insert adds an entry and evicts from the back until within budget.
+// Callers must hold c.mu (or own c exclusively, as during load).
+func (c *TranslationCache) insert(key string, entry cacheEntry) {
+	el := c.order.PushFront(&lruItem{key: key, entry: entry})
+	c.items[key] = el
+	c.bytes += entrySize(key, entry)
+
+	for c.overBudget() {
+		oldest := c.order.Back()
+		if oldest == nil || oldest == el {
+			break
+		}
+		c.remove(oldest)
+		c.stats.Evictions++
+	}
+}
+
+func (c *TranslationCache) overBudget() bool {
+	if c.maxEntries > 0 && len(c.items) > c.maxEntries {
+		return true
+	}
+	return c.maxBytes > 0 && c.bytes > c.maxBytes
+}
+
+func (c *TranslationCache) remove(el *list.Element) {
+	item := el.Value.(*lruItem)
+	c.order.Remove(el)
+	delete(c.items, item.key)
+	c.bytes -= entrySize(item.key, item.entry)
+	if c.store != nil {
+		if err := c.store.Delete(item.key); err != nil {
+			slog.Error("failed to delete cache entry", "error", err)
+		}
+	}
+}
+
+// Sweep removes every expired entry and returns how many were removed.
+func (c *TranslationCache) Sweep() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for el := c.order.Back(); el != nil; {
+		prev := el.Prev()
+		if c.expired(el.Value.(*lruItem).entry) {
+			c.remove(el)
+			removed++
+		}
+		el = prev
+	}
+	c.stats.Expirations += int64(removed)
+	return removed
+}
+
+func (c *TranslationCache) janitor(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if removed := c.Sweep(); removed > 0 {
+				slog.Info("translation cache swept", "removed", removed)
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *TranslationCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.items)
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// Close stops the janitor and closes the store, if any.
+func (c *TranslationCache) Close() error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	if c.store != nil {
+		return c.store.Close()
+	}
+	return nil
+}
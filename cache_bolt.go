@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var translationsBucket = []byte("translations")
+
+// BoltCacheStore keeps cache entries in a BoltDB file.
+type BoltCacheStore struct {
+	db *bolt.DB
+}
+
+type boltCacheRecord struct {
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewBoltCacheStore(path string) (*BoltCacheStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(translationsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltCacheStore{db: db}, nil
+}
+
+func (s *BoltCacheStore) Load(fn func(key string, entry cacheEntry)) error {
+	var entries []lruItem
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(translationsBucket).ForEach(func(k, v []byte) error {
+			var record boltCacheRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return nil // skip corrupt records rather than failing startup
+			}
+			entries = append(entries, lruItem{
+				key:   string(k),
+				entry: cacheEntry{text: record.Text, createdAt: record.CreatedAt},
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	// Oldest first, so the most recent translations end up at the front
+	// of the LRU.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].entry.createdAt.Before(entries[j].entry.createdAt)
+	})
+	// fn may delete expired keys, which needs a write transaction, so it
+	// runs after the read transaction is closed.
+	for _, item := range entries {
+		fn(item.key, item.entry)
+	}
+	return nil
+}
+
+func (s *BoltCacheStore) Put(key string, entry cacheEntry) error {
+	data, err := json.Marshal(boltCacheRecord{Text: entry.text, CreatedAt: entry.createdAt})
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(translationsBucket).Put([]byte(key), data)
+	})
+}
+
+func (s *BoltCacheStore) Delete(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(translationsBucket).Delete([]byte(key))
+	})
+}
+
+func (s *BoltCacheStore) Close() error {
+	return s.db.Close()
+}
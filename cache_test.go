@@ -0,0 +1,88 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewTranslationCache(CacheOptions{TTL: time.Minute, MaxEntries: 2})
+
+	cache.Set("a", "1")
+	cache.Set("b", "2")
+	cache.Get("a") // a is now more recent than b
+	cache.Set("c", "3")
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if _, ok := cache.Get("a"); !ok {
+		t.Error("expected a to survive")
+	}
+	if got := cache.Stats().Evictions; got != 1 {
+		t.Errorf("expected 1 eviction, got %d", got)
+	}
+}
+
+func TestCacheByteBudget(t *testing.T) {
+	cache := NewTranslationCache(CacheOptions{TTL: time.Minute, MaxBytes: 10})
+
+	cache.Set("k1", "aaaa") // 6 bytes
+	cache.Set("k2", "bbbb") // 6 bytes, pushes k1 out
+
+	stats := cache.Stats()
+	if stats.Entries != 1 || stats.Bytes != 6 {
+		t.Errorf("expected 1 entry / 6 bytes, got %d / %d", stats.Entries, stats.Bytes)
+	}
+}
+
+func TestCacheSweepRemovesExpired(t *testing.T) {
+	cache := NewTranslationCache(CacheOptions{TTL: 20 * time.Millisecond})
+	cache.Set("a", "1")
+
+	time.Sleep(30 * time.Millisecond)
+
+	if removed := cache.Sweep(); removed != 1 {
+		t.Errorf("expected 1 expired entry removed, got %d", removed)
+	}
+	if cache.Stats().Entries != 0 {
+		t.Error("expected cache to be empty")
+	}
+}
+
+func TestCacheHitMissCounters(t *testing.T) {
+	cache := NewTranslationCache(CacheOptions{TTL: time.Minute})
+	cache.Set("a", "1")
+	cache.Get("a")
+	cache.Get("missing")
+
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("expected 1 hit / 1 miss, got %d / %d", stats.Hits, stats.Misses)
+	}
+}
+
+func TestCachePersistsAcrossRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	store, err := NewBoltCacheStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cache := NewTranslationCache(CacheOptions{TTL: time.Minute, Store: store})
+	cache.Set("es:en:hola", "hello")
+	cache.Close()
+
+	store, err = NewBoltCacheStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cache = NewTranslationCache(CacheOptions{TTL: time.Minute, Store: store})
+	defer cache.Close()
+
+	got, ok := cache.Get("es:en:hola")
+	if !ok || got != "hello" {
+		t.Errorf("expected hello after restart, got %q (found %v)", got, ok)
+	}
+}
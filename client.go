@@ -2,16 +2,91 @@ package main
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Role is what a client is allowed to do.
+type Role string
+
+const (
+	RoleCustomer   Role = "customer"
+	RoleAgent      Role = "agent"
+	RoleSupervisor Role = "supervisor"
+	RoleAdmin      Role = "admin"
+)
+
+// roleRank orders roles so routes can require "at least" one of them.
+var roleRank = map[Role]int{
+	RoleCustomer:   0,
+	RoleAgent:      1,
+	RoleSupervisor: 2,
+	RoleAdmin:      3,
+}
+
+// AtLeast reports whether r carries min's permissions. Unknown roles carry
+// none.
+func (r Role) AtLeast(min Role) bool {
+	rank, ok := roleRank[r]
+	return ok && rank >= roleRank[min]
+}
+
+// LanguageSource is how a customer's language was chosen.
+type LanguageSource string
 
-	"github.com/coder/websocket"
+const (
+	// LanguageDeclared was chosen by the customer, in /start-chat or with
+	// set_language. Detection never overrides it.
+	LanguageDeclared LanguageSource = "declared"
+	// LanguageBrowser came from the Accept-Language header because
+	// detection wasn't sure. Detection can override it.
+	LanguageBrowser LanguageSource = "browser"
+	// LanguageDetected was detected from what the customer wrote.
+	LanguageDetected LanguageSource = "detected"
 )
 
 type Client struct {
-	Token      string
-	Name       string
-	Language   string
-	Connection *websocket.Conn
+	Token    string
+	Name     string
+	Language string
+	// LanguageConfidence is how sure detection was of Language, from 0 to
+	// 1; 0 when nobody detected it.
+	LanguageConfidence float64
+	// LanguageSource says whether Language was declared or detected.
+	LanguageSource LanguageSource
+	Role           Role
+	// Account is the username a staff client logged in with; empty for
+	// customers.
+	Account string
+	// Languages are extra languages an agent speaks natively, on top of
+	// Language. Skills are topics they handle (billing, technical, ...).
+	Languages []string
+	Skills    []string
+	// MaxRooms caps how many active rooms the queue gives an agent at once.
+	MaxRooms int
+	// Connection writes to the client's WebSocket when it's open on this
+	// instance. Hub.mu guards it; Hub.Deliver is the way to send.
+	Connection *Outbox
+	// Streaming is set when the client's socket opted in to message_delta
+	// frames with /ws?stream=true.
+	Streaming bool
+	// Online is true while the client has a WebSocket open on any instance.
+	Online bool
+
+	unsubscribe func()
+	// session is the token session the local WebSocket was opened with, so
+	// revoking it can close the socket.
+	session string
+	// lastSeen and owner drive the idle sweeper: only the instance that
+	// created a client removes it.
+	lastSeen time.Time
+	owner    string
+	// pendingLanguage is a new language the client's last message was
+	// confidently detected in; see Hub.ObserveLanguage.
+	pendingLanguage string
 }
 
 func NewClient(name string, language string) *Client {
@@ -23,6 +98,68 @@ func NewClient(name string, language string) *Client {
 	}
 }
 
+// ID identifies the client to other users without revealing the token,
+// which is a bearer credential.
+func (c *Client) ID() string {
+	sum := sha256.Sum256([]byte(c.Token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// capacity is how many active rooms the agent can take; at least one.
+func (c *Client) capacity() int {
+	return max(c.MaxRooms, 1)
+}
+
+// baseLanguage reduces a tag like "pt-BR" to "pt" for comparison.
+func baseLanguage(tag string) string {
+	base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	return base
+}
+
+// Speaks reports whether the client speaks language natively.
+func (c *Client) Speaks(language string) bool {
+	return speaks(c.Language, c.Languages, language)
+}
+
+// speaks reports whether someone whose language is primary, and who also
+// speaks others, speaks language natively.
+func speaks(primary string, others []string, language string) bool {
+	if language == "" {
+		return false
+	}
+	want := baseLanguage(language)
+	if baseLanguage(primary) == want {
+		return true
+	}
+	return slices.ContainsFunc(others, func(l string) bool {
+		return baseLanguage(l) == want
+	})
+}
+
+// party is a client as a pipeline job sees them: the fields translation
+// and delivery depend on, copied under Hub.mu (see Hub.Party). A
+// set_language, profile edit or reconnect while the job waits can't race
+// with the worker, and takes effect from the next job.
+type party struct {
+	client    *Client
+	name      string
+	language  string
+	source    LanguageSource
+	languages []string
+	streaming bool
+}
+
+func (p party) speaks(language string) bool {
+	return speaks(p.language, p.languages, language)
+}
+
+// HasSkill reports whether the client handles topic.
+func (c *Client) HasSkill(topic string) bool {
+	return slices.ContainsFunc(c.Skills, func(s string) bool {
+		return strings.EqualFold(s, topic)
+	})
+}
+
 func generateToken() string {
 	bytes := make([]byte, 16)
 	_, _ = rand.Read(bytes)
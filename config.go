@@ -3,30 +3,102 @@ package main
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Port            string
-	OllamaURL      string
-	OllamaModel    string
-	RateLimit       int
-	RateLimitWindow time.Duration
-	CacheTTL        time.Duration
+	Port                   string
+	Providers              []string
+	OllamaURL              string
+	OllamaModel            string
+	OpenAIURL              string
+	OpenAIModel            string
+	OpenAIKey              string
+	LibreTranslateURL      string
+	LibreTranslateKey      string
+	DatabasePath           string
+	RedisAddr              string
+	RateLimit              int
+	RateLimitWindow        time.Duration
+	CacheTTL               time.Duration
+	CacheMaxEntries        int
+	CacheMaxBytes          int
+	CacheJanitorEvery      time.Duration
+	CachePath              string
+	BreakerThreshold       int
+	BreakerCooldown        time.Duration
+	ProviderTimeout        time.Duration
+	AgentMaxRooms          int
+	AuthSecret             string
+	AuthTokenTTL           time.Duration
+	AccountsFile           string
+	ClientIdleTimeout      time.Duration
+	ClientSweepEvery       time.Duration
+	AllowedOrigins         []string
+	SendQueueSize          int
+	SlowConsumer           string
+	WriteTimeout           time.Duration
+	PingInterval           time.Duration
+	TranslationConcurrency int
+	PipelineQueueSize      int
 }
 
 func LoadConfig() Config {
 	rateLimit, _ := strconv.Atoi(envOrDefault("RATE_LIMIT", "10"))
 	rateLimitWindow, _ := time.ParseDuration(envOrDefault("RATE_LIMIT_WINDOW", "1m"))
 	cacheTTL, _ := time.ParseDuration(envOrDefault("CACHE_TTL", "10m"))
+	cacheMaxEntries, _ := strconv.Atoi(envOrDefault("CACHE_MAX_ENTRIES", "10000"))
+	cacheMaxBytes, _ := strconv.Atoi(envOrDefault("CACHE_MAX_BYTES", "16777216"))
+	cacheJanitorEvery, _ := time.ParseDuration(envOrDefault("CACHE_JANITOR_INTERVAL", "1m"))
+	breakerThreshold, _ := strconv.Atoi(envOrDefault("BREAKER_THRESHOLD", "3"))
+	breakerCooldown, _ := time.ParseDuration(envOrDefault("BREAKER_COOLDOWN", "30s"))
+	providerTimeout, _ := time.ParseDuration(envOrDefault("PROVIDER_TIMEOUT", "10s"))
+	agentMaxRooms, _ := strconv.Atoi(envOrDefault("AGENT_MAX_ROOMS", "3"))
+	authTokenTTL, _ := time.ParseDuration(envOrDefault("AUTH_TOKEN_TTL", "12h"))
+	clientIdleTimeout, _ := time.ParseDuration(envOrDefault("CLIENT_IDLE_TIMEOUT", "30m"))
+	clientSweepEvery, _ := time.ParseDuration(envOrDefault("CLIENT_SWEEP_INTERVAL", "1m"))
+	sendQueueSize, _ := strconv.Atoi(envOrDefault("SEND_QUEUE_SIZE", "64"))
+	writeTimeout, _ := time.ParseDuration(envOrDefault("WRITE_TIMEOUT", "10s"))
+	pingInterval, _ := time.ParseDuration(envOrDefault("PING_INTERVAL", "30s"))
+	translationConcurrency, _ := strconv.Atoi(envOrDefault("TRANSLATION_CONCURRENCY", "4"))
+	pipelineQueueSize, _ := strconv.Atoi(envOrDefault("PIPELINE_QUEUE_SIZE", "256"))
 
 	return Config{
-		Port:            ":" + envOrDefault("PORT", "8080"),
-		OllamaURL:       envOrDefault("OLLAMA_URL", "http://localhost:11434"),
-		OllamaModel:     envOrDefault("OLLAMA_MODEL", "llama3.2"),
-		RateLimit:        rateLimit,
-		RateLimitWindow:  rateLimitWindow,
-		CacheTTL:         cacheTTL,
+		Port:                   ":" + envOrDefault("PORT", "8080"),
+		Providers:              splitList(envOrDefault("TRANSLATION_PROVIDERS", envOrDefault("TRANSLATION_PROVIDER", "ollama"))),
+		OllamaURL:              envOrDefault("OLLAMA_URL", "http://localhost:11434"),
+		OllamaModel:            envOrDefault("OLLAMA_MODEL", "llama3.2"),
+		OpenAIURL:              envOrDefault("OPENAI_URL", "https://api.openai.com"),
+		OpenAIModel:            envOrDefault("OPENAI_MODEL", "gpt-4o-mini"),
+		OpenAIKey:              os.Getenv("OPENAI_API_KEY"),
+		LibreTranslateURL:      envOrDefault("LIBRETRANSLATE_URL", "http://localhost:5000"),
+		LibreTranslateKey:      os.Getenv("LIBRETRANSLATE_API_KEY"),
+		DatabasePath:           os.Getenv("DATABASE_PATH"),
+		RedisAddr:              os.Getenv("REDIS_ADDR"),
+		RateLimit:              rateLimit,
+		RateLimitWindow:        rateLimitWindow,
+		CacheTTL:               cacheTTL,
+		CacheMaxEntries:        cacheMaxEntries,
+		CacheMaxBytes:          cacheMaxBytes,
+		CacheJanitorEvery:      cacheJanitorEvery,
+		CachePath:              os.Getenv("CACHE_PATH"),
+		BreakerThreshold:       breakerThreshold,
+		BreakerCooldown:        breakerCooldown,
+		ProviderTimeout:        providerTimeout,
+		AgentMaxRooms:          agentMaxRooms,
+		AuthSecret:             os.Getenv("AUTH_SECRET"),
+		AuthTokenTTL:           authTokenTTL,
+		AccountsFile:           os.Getenv("ACCOUNTS_FILE"),
+		ClientIdleTimeout:      clientIdleTimeout,
+		ClientSweepEvery:       clientSweepEvery,
+		AllowedOrigins:         splitList(os.Getenv("ALLOWED_ORIGINS")),
+		SendQueueSize:          sendQueueSize,
+		SlowConsumer:           envOrDefault("SLOW_CONSUMER_POLICY", string(OverflowDisconnect)),
+		WriteTimeout:           writeTimeout,
+		PingInterval:           pingInterval,
+		TranslationConcurrency: translationConcurrency,
+		PipelineQueueSize:      pipelineQueueSize,
 	}
 }
 
@@ -36,3 +108,14 @@ func envOrDefault(key string, fallback string) string {
 	}
 	return fallback
 }
+
+// splitList parses a comma-separated env value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"unicode"
+)
+
+const (
+	// confidentDetection is how sure the local detector must be to answer
+	// without asking the backend.
+	confidentDetection = 0.8
+	// switchConfidence is how sure a detection must be to count towards
+	// changing a customer's known language.
+	switchConfidence = 0.7
+	// minRedetectLetters is the shortest message that can change a known
+	// language; "ok", "sim" or an order number never do.
+	minRedetectLetters = 12
+	// backendConfidence is what a backend's answer is worth on its own,
+	// and agreedConfidence what it's worth when the local guess agrees.
+	backendConfidence = 0.75
+	agreedConfidence  = 0.95
+)
+
+// Where a Detection came from.
+const (
+	SourceLocal   = "local"
+	SourceBackend = "backend"
+)
+
+// Detection is the language a text was found to be in, as an ISO 639-1
+// code or BCP 47 tag, with a confidence between 0 and 1.
+type Detection struct {
+	Language   string  `json:"language"`
+	Confidence float64 `json:"confidence"`
+	Source     string  `json:"source"`
+}
+
+// Detect works out what language text is in. The local detector answers
+// when it's sure; short or ambiguous text goes to the backend, whose answer
+// is validated against ISO 639 and weighed against the local guess. If the
+// backend fails or answers nonsense, the local guess stands, however
+// unsure.
+func (t *Translator) Detect(ctx context.Context, text string) (Detection, error) {
+	local := detectLocal(text)
+	if local.Confidence >= confidentDetection {
+		return local, nil
+	}
+
+	answer, err := t.DetectLanguage(ctx, text)
+	if err == nil {
+		language, ok := parseLanguage(answer)
+		if !ok {
+			err = fmt.Errorf("backend answered %q, which isn't a language", answer)
+		} else {
+			detection := Detection{Language: language, Confidence: backendConfidence, Source: SourceBackend}
+			if local.Language != "" && baseLanguage(local.Language) == baseLanguage(language) {
+				detection.Confidence = max(agreedConfidence, local.Confidence)
+			}
+			return detection, nil
+		}
+	}
+	if local.Language == "" {
+		return Detection{}, err
+	}
+	slog.Warn("language detection fell back to local guess", "language", local.Language, "confidence", local.Confidence, "error", err)
+	return local, nil
+}
+
+// ObserveLanguage applies a detection of something client wrote. A client
+// whose language is unknown takes any detection. A known language only
+// changes after two confident detections in a row agree on a new one, so a
+// single quoted phrase or product name doesn't flip it, and a declared one
+// never does. It reports whether the client's language changed.
+func (h *Hub) ObserveLanguage(client *Client, detection Detection) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch {
+	case detection.Language == "" || client.LanguageSource == LanguageDeclared:
+		return false
+	case client.Language == "":
+	case baseLanguage(detection.Language) == baseLanguage(client.Language):
+		client.pendingLanguage = ""
+		if detection.Confidence > client.LanguageConfidence {
+			client.LanguageConfidence = detection.Confidence
+			h.saveClient(client)
+		}
+		return false
+	case detection.Confidence < switchConfidence:
+		return false
+	case baseLanguage(client.pendingLanguage) != baseLanguage(detection.Language):
+		client.pendingLanguage = detection.Language
+		return false
+	}
+
+	client.Language = detection.Language
+	client.LanguageConfidence = detection.Confidence
+	client.LanguageSource = LanguageDetected
+	client.pendingLanguage = ""
+	h.saveClient(client)
+	return true
+}
+
+// DeclareLanguage sets the language client says they speak. Detection
+// leaves it alone from then on; only another declaration changes it.
+func (h *Hub) DeclareLanguage(client *Client, language string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	client.Language = language
+	client.LanguageConfidence = 0
+	client.LanguageSource = LanguageDeclared
+	client.pendingLanguage = ""
+	h.saveClient(client)
+}
+
+// letterCount counts the letters in text, ignoring digits, punctuation and
+// emoji.
+func letterCount(text string) int {
+	n := 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDetectLocal(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want string
+	}{
+		{"Olá, o meu cartão foi recusado ontem e não sei porquê", "pt"},
+		{"Hola, mi tarjeta fue rechazada ayer y no sé por qué", "es"},
+		{"Bonjour, ma carte a été refusée hier et je ne sais pas pourquoi", "fr"},
+		{"Hallo, meine Karte wurde gestern abgelehnt und ich weiß nicht warum", "de"},
+		{"Ciao, la mia carta è stata rifiutata ieri e non so perché", "it"},
+		{"Hallo, mijn kaart werd gisteren geweigerd en ik weet niet waarom", "nl"},
+		{"Hi, my card was declined yesterday and I don't know why", "en"},
+		{"안녕하세요, 카드가 거절되었어요", "ko"},
+		{"昨日カードが拒否されました", "ja"},
+		{"我的卡昨天被拒绝了", "zh"},
+		{"Γεια σας, η κάρτα μου απορρίφθηκε", "el"},
+	} {
+		got := detectLocal(tc.text)
+		if got.Language != tc.want || got.Confidence < confidentDetection {
+			t.Errorf("%q: expected confident %s, got %+v", tc.text, tc.want, got)
+		}
+	}
+
+	// Too short to tell, nothing to go on, or a language without a profile.
+	for _, text := range []string{"ok", "obrigado", "12345 !!", "Hej, mitt kort nekades igår och jag vet inte varför"} {
+		if got := detectLocal(text); got.Confidence >= confidentDetection {
+			t.Errorf("%q: expected low confidence, got %+v", text, got)
+		}
+	}
+}
+
+func TestDetectAsksBackendWhenUnsure(t *testing.T) {
+	provider := NewFakeProvider()
+	provider.Language = "Portuguese."
+	translator := NewTranslator(provider, NewTranslationCache(CacheOptions{TTL: time.Minute}))
+
+	got, err := translator.Detect(context.Background(), "Hi, my card was declined yesterday and I don't know why")
+	if err != nil || got.Language != "en" || got.Source != SourceLocal || provider.Calls() != 0 {
+		t.Errorf("expected a local answer for clear text, got %+v after %d calls (%v)", got, provider.Calls(), err)
+	}
+
+	got, err = translator.Detect(context.Background(), "obrigado")
+	if err != nil || got.Language != "pt" || got.Source != SourceBackend || provider.Calls() != 1 {
+		t.Errorf("expected the backend's answer for short text, got %+v after %d calls (%v)", got, provider.Calls(), err)
+	}
+
+	// Nonsense from the backend is never taken as a language.
+	provider.Language = "This text seems to be a greeting."
+	if got, _ := translator.Detect(context.Background(), "obrigado"); got.Language != "pt" || got.Source != SourceLocal {
+		t.Errorf("expected the local guess, got %+v", got)
+	}
+	if _, err := translator.Detect(context.Background(), "12345"); err == nil {
+		t.Error("expected an error when neither detector has an answer")
+	}
+
+	provider.Err = errors.New("backend down")
+	if got, err := translator.Detect(context.Background(), "obrigado"); err != nil || got.Language != "pt" {
+		t.Errorf("expected the local guess when the backend fails, got %+v (%v)", got, err)
+	}
+}
+
+func TestObserveLanguageSwitchesAfterTwoMessages(t *testing.T) {
+	hub := newTestHub(t)
+	alice := NewClient("Alice", "")
+	hub.AddClient(alice)
+	spanish := Detection{Language: "es", Confidence: 0.9}
+
+	if !hub.ObserveLanguage(alice, Detection{Language: "pt", Confidence: 0.4}) || alice.Language != "pt" {
+		t.Fatalf("expected an unknown language to take any detection, got %q", alice.Language)
+	}
+	if hub.ObserveLanguage(alice, spanish) || alice.Language != "pt" {
+		t.Fatalf("expected one message not to switch language, got %q", alice.Language)
+	}
+	// Back in Portuguese: the Spanish message was a one-off.
+	hub.ObserveLanguage(alice, Detection{Language: "pt", Confidence: 0.9})
+	if hub.ObserveLanguage(alice, spanish) || alice.Language != "pt" {
+		t.Fatalf("expected a Portuguese message in between to reset the switch, got %q", alice.Language)
+	}
+	// An unsure message in between counts neither way.
+	if hub.ObserveLanguage(alice, Detection{Language: "fr", Confidence: 0.5}) {
+		t.Fatal("expected an unsure detection not to switch language")
+	}
+	if !hub.ObserveLanguage(alice, spanish) || alice.Language != "es" {
+		t.Fatalf("expected a second confident Spanish message to switch language, got %q", alice.Language)
+	}
+	if alice.LanguageConfidence != 0.9 {
+		t.Errorf("expected the switch to record its confidence, got %v", alice.LanguageConfidence)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// fanOut delivers a recorded message from sender to every recipient. It
+// translates once per distinct target language, with the languages running
+// concurrently so a slow one doesn't hold up the rest, and each recipient
+// gets their own view of the result (see messageView). Recipients who
+// stream get deltas for their language as it's produced. It returns the
+// languages translation failed for, whose recipients got the original.
+func fanOut(ctx context.Context, hub *Hub, translator *Translator, room *Room, sender party, recipients []party, recorded ChatMessage) []string {
+	groups := make(map[string][]party)
+	for _, recipient := range recipients {
+		target := translationTarget(sender, recipient)
+		groups[target] = append(groups[target], recipient)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+	)
+	for target, group := range groups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			translated, err := translateFor(ctx, hub, translator, room, sender, group, recorded.Content, target, recorded.ID)
+			if err != nil {
+				mu.Lock()
+				failed = append(failed, target)
+				mu.Unlock()
+			}
+			for _, recipient := range group {
+				msg := messageView(room, sender, recipient, recorded.Content, translated)
+				msg.Type = recorded.Type
+				msg.ID = recorded.ID
+				msg.Seq = recorded.Seq
+				msg.SentAt = recorded.SentAt
+				data, _ := json.Marshal(msg)
+				if err := hub.Deliver(ctx, recipient.client, data); err != nil {
+					slog.Error("failed to send message", "recipient", recipient.name, "error", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	slices.Sort(failed)
+	return failed
+}
+
+// translateFor translates content into target for group, streaming deltas
+// to the group members who asked for them. It returns "" when target is
+// empty, and "" with the error when translation fails, so the group gets
+// the original.
+func translateFor(ctx context.Context, hub *Hub, translator *Translator, room *Room, sender party, group []party, content string, target string, id string) (string, error) {
+	if target == "" {
+		return "", nil
+	}
+
+	var streams []func(delta string)
+	for _, recipient := range group {
+		if recipient.streaming {
+			streams = append(streams, streamDeltas(ctx, hub, recipient, room, sender, id))
+		}
+	}
+
+	var translated string
+	var err error
+	if len(streams) > 0 {
+		translated, err = translator.TranslateStream(ctx, content, sender.language, target, func(delta string) {
+			for _, stream := range streams {
+				stream(delta)
+			}
+		})
+	} else {
+		translated, err = translator.Translate(ctx, content, sender.language, target)
+	}
+	if err != nil {
+		slog.Error("translation failed", "language", target, "error", err)
+		return "", err
+	}
+	return translated, nil
+}
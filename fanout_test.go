@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// captureFrames collects what the hub delivers to client over the bus,
+// which is where frames go for clients without a local socket.
+func captureFrames(t *testing.T, hub *Hub, client *Client) <-chan ChatMessage {
+	t.Helper()
+	frames := make(chan ChatMessage, 8)
+	unsubscribe, err := hub.bus.Subscribe(clientTopic(client.Token), func(data []byte) {
+		var msg ChatMessage
+		json.Unmarshal(data, &msg)
+		frames <- msg
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(unsubscribe)
+	return frames
+}
+
+func receive(t *testing.T, frames <-chan ChatMessage) ChatMessage {
+	t.Helper()
+	select {
+	case msg := <-frames:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for frame")
+		return ChatMessage{}
+	}
+}
+
+// parties copies clients as a pipeline job would see them.
+func parties(hub *Hub, clients ...*Client) []party {
+	var out []party
+	for _, client := range clients {
+		out = append(out, hub.Party(client))
+	}
+	return out
+}
+
+func TestFanOutTranslatesOncePerLanguage(t *testing.T) {
+	hub := newTestHub(t)
+	provider := NewFakeProvider()
+	translator := NewTranslator(provider, NewTranslationCache(CacheOptions{TTL: time.Minute}))
+
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	alice := room.Customer // pt
+	sam := NewClient("Sam", "es")
+	dan := NewClient("Dan", "es")
+	lea := NewClient("Lea", "en")
+
+	frames := map[*Client]<-chan ChatMessage{}
+	for _, c := range []*Client{alice, sam, dan, lea} {
+		frames[c] = captureFrames(t, hub, c)
+	}
+
+	fanOut(context.Background(), hub, translator, room, hub.Party(bob), parties(hub, alice, sam, dan, lea), ChatMessage{Type: "message", ID: "msg_1", Content: "Hello"})
+
+	if msg := receive(t, frames[alice]); msg.Content != "[pt] Hello" || msg.TranslatedContent != "" {
+		t.Errorf("expected customer to see the translation only, got %+v", msg)
+	}
+	for _, c := range []*Client{sam, dan} {
+		if msg := receive(t, frames[c]); msg.Content != "Hello" || msg.TranslatedContent != "[es] Hello" {
+			t.Errorf("expected %s to see original and translation, got %+v", c.Name, msg)
+		}
+	}
+	if msg := receive(t, frames[lea]); msg.Content != "Hello" || msg.TranslatedContent != "" || msg.ID != "msg_1" {
+		t.Errorf("expected Lea to see the untranslated original, got %+v", msg)
+	}
+	if calls := provider.Calls(); calls != 2 {
+		t.Errorf("expected one translation per language (2), got %d", calls)
+	}
+}
+
+func TestFanOutTranslatesLanguagesConcurrently(t *testing.T) {
+	hub := newTestHub(t)
+	provider := NewFakeProvider()
+	provider.Delay = 200 * time.Millisecond
+	translator := NewTranslator(provider, NewTranslationCache(CacheOptions{TTL: time.Minute}))
+
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	recipients := parties(hub, room.Customer, NewClient("Sam", "es"), NewClient("Fay", "fr"))
+
+	start := time.Now()
+	fanOut(context.Background(), hub, translator, room, hub.Party(bob), recipients, ChatMessage{Type: "message", ID: "msg_1", Content: "Hello"})
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected three languages to translate in parallel, took %s", elapsed)
+	}
+}
+
+func TestFanOutReportsFailedLanguages(t *testing.T) {
+	hub := newTestHub(t)
+	provider := NewFakeProvider()
+	provider.Err = errors.New("provider down")
+	translator := NewTranslator(provider, NewTranslationCache(CacheOptions{TTL: time.Minute}))
+
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	alice := room.Customer // pt
+	frames := captureFrames(t, hub, alice)
+
+	failed := fanOut(context.Background(), hub, translator, room, hub.Party(bob), parties(hub, alice, NewClient("Lea", "en")), ChatMessage{Type: "message", ID: "msg_1", Content: "Hello"})
+	if len(failed) != 1 || failed[0] != "pt" {
+		t.Errorf("expected pt to be reported as failed, got %v", failed)
+	}
+	if msg := receive(t, frames); msg.Content != "Hello" {
+		t.Errorf("expected customer to get the original, got %+v", msg)
+	}
+}
+
+func TestInviteAddsMember(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	sam := NewClient("Sam", "es")
+	sam.Role = RoleAgent
+	hub.AddClient(sam)
+
+	if err := hub.Invite(room, bob, sam, ""); err == nil {
+		t.Fatal("expected offline invitee to be rejected")
+	}
+	sam.Online = true
+	if err := hub.Invite(room, bob, sam, "needs Spanish"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !hub.IsMember(room, sam) {
+		t.Error("expected Sam to be a member of the room")
+	}
+	if audience := hub.Audience(room, room.Customer, false); len(audience) != 2 {
+		t.Errorf("expected customer messages to reach Bob and Sam, got %d recipients", len(audience))
+	}
+}
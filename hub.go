@@ -1,56 +1,257 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
+// roomCloseDelay is how long a room stays in RoomClosing after the agent
+// leaves, giving the customer a chance to reopen it.
+const roomCloseDelay = 5 * time.Minute
+
+var errAgentAtCapacity = errors.New("agent is at capacity")
+
 type Hub struct {
 	Clients map[string]*Client
 	Rooms   map[string]*Room
 	mu      sync.Mutex
+	store   Store
+
+	bus        Bus
+	instanceID string
+	// events holds state changes waiting to be published; see emit.
+	events chan []byte
+
+	// Outbound configures the writer of every socket connected from now
+	// on; set it before serving.
+	Outbound OutboxOptions
+
+	// available maps agent tokens to when they became available.
+	available map[string]time.Time
+	// revoked maps logged-out token sessions to when their last token
+	// expires.
+	revoked map[string]time.Time
+	// usedTickets maps spent connect tickets to when they expire.
+	usedTickets map[string]time.Time
+	// typing maps typingKey(client, room) to when that client's last
+	// typing_start was relayed.
+	typing map[string]time.Time
+
+	// now tells the time for revocations and sweeps; tests move it.
+	now func() time.Time
+}
+
+// NewHub creates a hub backed by store and rehydrates any clients, rooms
+// and messages the store already holds. State changes are shared with
+// other instances over bus.
+func NewHub(store Store, bus Bus) (*Hub, error) {
+	h := &Hub{
+		Clients:     make(map[string]*Client),
+		Rooms:       make(map[string]*Room),
+		store:       store,
+		bus:         bus,
+		instanceID:  generateToken(),
+		events:      make(chan []byte, eventQueueSize),
+		available:   make(map[string]time.Time),
+		revoked:     make(map[string]time.Time),
+		usedTickets: make(map[string]time.Time),
+		typing:      make(map[string]time.Time),
+		now:         time.Now,
+	}
+	if err := h.restore(); err != nil {
+		return nil, err
+	}
+	if _, err := bus.Subscribe(hubTopic, h.applyEvent); err != nil {
+		return nil, fmt.Errorf("subscribing to hub events: %w", err)
+	}
+	go h.publishEvents()
+	return h, nil
 }
 
-func NewHub() *Hub {
-	return &Hub{
-		Clients: make(map[string]*Client),
-		Rooms:   make(map[string]*Room),
+func (h *Hub) restore() error {
+	snapshot, err := h.store.Load()
+	if err != nil {
+		return fmt.Errorf("loading store: %w", err)
 	}
+
+	for _, c := range snapshot.Clients {
+		h.Clients[c.Token] = &Client{
+			Token:              c.Token,
+			Name:               c.Name,
+			Language:           c.Language,
+			LanguageConfidence: c.LanguageConfidence,
+			LanguageSource:     c.LanguageSource,
+			Role:               c.Role,
+			Account:            c.Account,
+			Languages:          c.Languages,
+			Skills:             c.Skills,
+			MaxRooms:           c.MaxRooms,
+			lastSeen:           time.Now(),
+			owner:              h.instanceID,
+		}
+	}
+	for session, until := range snapshot.Revocations {
+		h.revoked[session] = until
+	}
+
+	for _, r := range snapshot.Rooms {
+		customer, ok := h.Clients[r.CustomerToken]
+		if !ok {
+			slog.Warn("dropping room with unknown customer", "room", r.ID)
+			continue
+		}
+		room := NewRoom(r.ID, customer)
+		room.Status = r.Status
+		room.Topic = r.Topic
+		room.TransferredFrom = r.TransferredFrom
+		room.TransferNote = r.TransferNote
+		room.CreatedAt = r.CreatedAt
+		room.WaitingSince = r.CreatedAt
+		room.owner = h.instanceID
+		room.Agent = h.Clients[r.AgentToken]
+		room.Messages = snapshot.Messages[r.ID]
+		h.Rooms[room.ID] = room
+
+		// The original close timer died with the old process.
+		if room.Status == RoomClosing {
+			h.scheduleClose(room)
+		}
+	}
+
+	slog.Info("hub restored", "clients", len(h.Clients), "rooms", len(h.Rooms))
+	return nil
+}
+
+func clientRecord(client *Client) ClientRecord {
+	return ClientRecord{
+		Token:              client.Token,
+		Name:               client.Name,
+		Language:           client.Language,
+		LanguageConfidence: client.LanguageConfidence,
+		LanguageSource:     client.LanguageSource,
+		Role:               client.Role,
+		Account:            client.Account,
+		Languages:          client.Languages,
+		Skills:             client.Skills,
+		MaxRooms:           client.MaxRooms,
+	}
+}
+
+func roomRecord(room *Room) RoomRecord {
+	record := RoomRecord{
+		ID:              room.ID,
+		Status:          room.Status,
+		Topic:           room.Topic,
+		TransferredFrom: room.TransferredFrom,
+		TransferNote:    room.TransferNote,
+		CreatedAt:       room.CreatedAt,
+	}
+	if room.Customer != nil {
+		record.CustomerToken = room.Customer.Token
+	}
+	if room.Agent != nil {
+		record.AgentToken = room.Agent.Token
+	}
+	return record
+}
+
+// persist logs store errors rather than failing the request: the in-memory
+// state is still correct, we've only lost durability for this change.
+func persist(action string, err error) {
+	if err != nil {
+		slog.Error("store write failed", "action", action, "error", err)
+	}
+}
+
+// saveRoom persists and replicates a room. Callers must hold h.mu.
+func (h *Hub) saveRoom(room *Room) {
+	record := roomRecord(room)
+	persist("save room", h.store.SaveRoom(record))
+	h.emit(hubEvent{Kind: eventRoomSaved, Room: &record})
+}
+
+// saveClient persists and replicates a client. Callers must hold h.mu.
+func (h *Hub) saveClient(client *Client) {
+	record := clientRecord(client)
+	persist("save client", h.store.SaveClient(record))
+	h.emit(hubEvent{Kind: eventClientSaved, Client: &record})
 }
 
 func (h *Hub) AddClient(client *Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	client.lastSeen = time.Now()
+	client.owner = h.instanceID
 	h.Clients[client.Token] = client
+	h.saveClient(client)
 	slog.Info("client added", "token", client.Token, "total", len(h.Clients))
 }
 
+// UpdateClient applies change to a client's profile under the hub lock,
+// so pipeline workers and other requests never see it half-done, and
+// persists the result.
+func (h *Hub) UpdateClient(client *Client, change func(c *Client)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	change(client)
+	h.saveClient(client)
+}
+
+// Profile returns a copy of client's profile, safe to read while
+// set_language or POST /profile change it.
+func (h *Hub) Profile(client *Client) ClientRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return clientRecord(client)
+}
+
 func (h *Hub) RemoveClient(token string) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	h.removeClient(token)
+}
+
+// removeClient forgets a client; tokens issued for it stop working.
+// Callers must hold h.mu.
+func (h *Hub) removeClient(token string) {
 	delete(h.Clients, token)
+	delete(h.available, token)
+	persist("delete client", h.store.DeleteClient(token))
+	h.emit(hubEvent{Kind: eventClientRemoved, Token: token})
 	slog.Info("client removed", "token", token, "total", len(h.Clients))
 }
 
-func (h *Hub) CreateRoom(customer *Client) *Room {
+// CreateRoom queues a new room for customer. topic may be empty.
+func (h *Hub) CreateRoom(customer *Client, topic string) *Room {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 	roomID := "room_" + generateToken()
 	room := NewRoom(roomID, customer)
+	room.Topic = topic
+	room.owner = h.instanceID
 	h.Rooms[roomID] = room
+	h.saveRoom(room)
 	slog.Info("room created", "room", roomID, "total", len(h.Rooms))
+	h.mu.Unlock()
+
+	h.Assign()
 	return room
 }
 
 func (h *Hub) JoinRoom(roomID string, agent *Client) (*Room, error) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	room, ok := h.Rooms[roomID]
+	room, ok := h.GetRoom(roomID)
 	if !ok {
 		return nil, fmt.Errorf("room not found: %s", roomID)
 	}
+	room.ops.Lock()
+	defer room.ops.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	if room.Status != RoomWaiting {
 		return nil, fmt.Errorf("room is not available: %s", roomID)
 	}
@@ -60,22 +261,86 @@ func (h *Hub) JoinRoom(roomID string, agent *Client) (*Room, error) {
 	if room.Customer == nil {
 		return nil, fmt.Errorf("customer is required: %s", roomID)
 	}
+	// Checked under the same lock as the join, so two joins at once can't
+	// both take an agent's last slot.
+	if h.agentLoad(agent.Token) >= agent.capacity() {
+		return nil, errAgentAtCapacity
+	}
+	if err := h.setStatus(room, RoomActive); err != nil {
+		return nil, err
+	}
 	room.Agent = agent
-	room.Status = RoomActive
+	h.saveRoom(room)
 	slog.Info("agent joined room", "room", roomID, "total", len(h.Rooms))
 	return room, nil
 }
 
-func (h *Hub) GetWaitingRooms() []*Room {
+// AddMessage records a message in the room's history, assigning its ID,
+// Seq and SentAt, and returns the recorded message.
+func (h *Hub) AddMessage(room *Room, msg ChatMessage) ChatMessage {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	var waitingRooms []*Room
-	for _, room := range h.Rooms {
-		if room.Status == RoomWaiting {
-			waitingRooms = append(waitingRooms, room)
+	msg.Seq = 1
+	if n := len(room.Messages); n > 0 {
+		msg.Seq = max(room.Messages[n-1].Seq, int64(n)) + 1
+	}
+	msg.ID = fmt.Sprintf("msg_%s_%d", strings.TrimPrefix(room.ID, "room_"), msg.Seq)
+	msg.SentAt = time.Now().UTC()
+	room.Messages = append(room.Messages, msg)
+	persist("append message", h.store.AppendMessage(room.ID, msg))
+	h.emit(hubEvent{Kind: eventMessageAdded, RoomID: room.ID, Message: &msg})
+	return msg
+}
+
+// History returns a copy of room's messages, safe to read while new ones
+// are recorded.
+func (h *Hub) History(room *Room) []ChatMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(room.Messages)
+}
+
+// MessageSender returns whoever sent msg as a party, for replaying it: the
+// room member (or, failing that, any client) whose ID matches
+// msg.SenderID, under the name and in the language the message was
+// recorded with. A message recorded without a language takes the
+// sender's current one.
+func (h *Hub) MessageSender(room *Room, msg ChatMessage) party {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	member := func() *Client {
+		candidates := []*Client{room.Customer, room.Agent}
+		for _, p := range room.Participants {
+			candidates = append(candidates, p.Client)
+		}
+		for _, client := range candidates {
+			if client != nil && client.ID() == msg.SenderID {
+				return client
+			}
 		}
+		for _, client := range h.Clients {
+			if client.ID() == msg.SenderID {
+				return client
+			}
+		}
+		return nil
+	}()
+	if member == nil {
+		return party{client: &Client{Name: msg.From}, name: msg.From, language: msg.Language}
+	}
+	sender := h.party(member)
+	sender.name = msg.From
+	if msg.Language != "" {
+		sender.language = msg.Language
 	}
-	return waitingRooms
+	return sender
+}
+
+// GetWaitingRooms returns waiting rooms in queue order, oldest first.
+func (h *Hub) GetWaitingRooms() []*Room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.waitingRooms()
 }
 
 func (h *Hub) GetRoom(roomID string) (*Room, bool) {
@@ -85,21 +350,34 @@ func (h *Hub) GetRoom(roomID string) (*Room, bool) {
 	return room, ok
 }
 
-func (h *Hub) IsAgentInRoom(agentToken string) bool {
+// CustomerRoom returns the open room client is the customer of.
+func (h *Hub) CustomerRoom(client *Client) (*Room, bool) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	for _, room := range h.Rooms {
-		if room.Agent != nil && room.Agent.Token == agentToken && room.Status == RoomActive {
-			return true
+		if room.Customer == client && room.Status != RoomClosed {
+			return room, true
 		}
 	}
-	return false
+	return nil, false
 }
 
 func (h *Hub) RemoveRoom(roomID string) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
+	h.removeRoom(roomID)
+	h.mu.Unlock()
+
+	h.Assign()
+}
+
+// removeRoom forgets a room. Callers must hold h.mu.
+func (h *Hub) removeRoom(roomID string) {
+	if room, ok := h.Rooms[roomID]; ok {
+		h.cancelClose(room)
+	}
 	delete(h.Rooms, roomID)
+	persist("delete room", h.store.DeleteRoom(roomID))
+	h.emit(hubEvent{Kind: eventRoomRemoved, RoomID: roomID})
 	slog.Info("room removed", "room", roomID, "total", len(h.Rooms))
 }
 
@@ -1,9 +1,22 @@
 package main
 
-import "testing"
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func newTestHub(t *testing.T) *Hub {
+	t.Helper()
+	hub, err := NewHub(NewMemoryStore(), NewLocalBus())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return hub
+}
 
 func TestAddAndGetClient(t *testing.T) {
-	hub := NewHub()
+	hub := newTestHub(t)
 	client := NewClient("Alice", "en")
 	hub.AddClient(client)
 
@@ -17,11 +30,11 @@ func TestAddAndGetClient(t *testing.T) {
 }
 
 func TestCreateAndGetRoom(t *testing.T) {
-	hub := NewHub()
+	hub := newTestHub(t)
 	customer := NewClient("Alice", "")
 	hub.AddClient(customer)
 
-	room := hub.CreateRoom(customer)
+	room := hub.CreateRoom(customer, "")
 
 	got, ok := hub.GetRoom(room.ID)
 	if !ok {
@@ -36,13 +49,13 @@ func TestCreateAndGetRoom(t *testing.T) {
 }
 
 func TestJoinRoom(t *testing.T) {
-	hub := NewHub()
+	hub := newTestHub(t)
 	customer := NewClient("Alice", "")
 	agent := NewClient("Bob", "en")
 	hub.AddClient(customer)
 	hub.AddClient(agent)
 
-	room := hub.CreateRoom(customer)
+	room := hub.CreateRoom(customer, "")
 	joined, err := hub.JoinRoom(room.ID, agent)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -56,12 +69,12 @@ func TestJoinRoom(t *testing.T) {
 }
 
 func TestJoinRoomAlreadyActive(t *testing.T) {
-	hub := NewHub()
+	hub := newTestHub(t)
 	customer := NewClient("Alice", "")
 	agent1 := NewClient("Bob", "en")
 	agent2 := NewClient("Carol", "en")
 
-	room := hub.CreateRoom(customer)
+	room := hub.CreateRoom(customer, "")
 	hub.JoinRoom(room.ID, agent1)
 
 	_, err := hub.JoinRoom(room.ID, agent2)
@@ -71,13 +84,13 @@ func TestJoinRoomAlreadyActive(t *testing.T) {
 }
 
 func TestGetWaitingRooms(t *testing.T) {
-	hub := NewHub()
+	hub := newTestHub(t)
 	c1 := NewClient("Alice", "")
 	c2 := NewClient("Bob", "")
 	agent := NewClient("Carol", "en")
 
-	room1 := hub.CreateRoom(c1)
-	hub.CreateRoom(c2)
+	room1 := hub.CreateRoom(c1, "")
+	hub.CreateRoom(c2, "")
 
 	hub.JoinRoom(room1.ID, agent)
 
@@ -88,9 +101,9 @@ func TestGetWaitingRooms(t *testing.T) {
 }
 
 func TestRemoveRoom(t *testing.T) {
-	hub := NewHub()
+	hub := newTestHub(t)
 	customer := NewClient("Alice", "")
-	room := hub.CreateRoom(customer)
+	room := hub.CreateRoom(customer, "")
 
 	hub.RemoveRoom(room.ID)
 
@@ -100,18 +113,107 @@ func TestRemoveRoom(t *testing.T) {
 	}
 }
 
-func TestIsAgentInRoom(t *testing.T) {
-	hub := NewHub()
+func TestAgentAtCapacity(t *testing.T) {
+	hub := newTestHub(t)
+	agent := NewClient("Bob", "en")
+	agent.MaxRooms = 2
+
+	first := hub.CreateRoom(NewClient("Alice", ""), "")
+	hub.JoinRoom(first.ID, agent)
+	if hub.AgentAtCapacity(agent) {
+		t.Fatal("expected agent with 1 of 2 rooms to have capacity")
+	}
+
+	second := hub.CreateRoom(NewClient("Carol", ""), "")
+	hub.JoinRoom(second.ID, agent)
+	if !hub.AgentAtCapacity(agent) {
+		t.Fatal("expected agent with 2 of 2 rooms to be at capacity")
+	}
+	if got := hub.AgentRooms(agent.Token); len(got) != 2 {
+		t.Errorf("expected 2 agent rooms, got %d", len(got))
+	}
+}
+
+func TestJoinRoomRespectsCapacityUnderRace(t *testing.T) {
+	hub := newTestHub(t)
+	agent := NewClient("Bob", "en")
+	rooms := []*Room{
+		hub.CreateRoom(NewClient("Alice", ""), ""),
+		hub.CreateRoom(NewClient("Carol", ""), ""),
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(rooms))
+	for i, room := range rooms {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = hub.JoinRoom(room.ID, agent)
+		}()
+	}
+	wg.Wait()
+
+	refused := 0
+	for _, err := range errs {
+		if errors.Is(err, errAgentAtCapacity) {
+			refused++
+		}
+	}
+	if refused != 1 || len(hub.AgentRooms(agent.Token)) != 1 {
+		t.Errorf("expected one join refused at capacity, got %v", errs)
+	}
+}
+
+func TestHubRestoresFromStore(t *testing.T) {
+	store := NewMemoryStore()
+	hub, _ := NewHub(store, NewLocalBus())
+	customer := NewClient("Alice", "pt")
+	agent := NewClient("Bob", "en")
+	hub.AddClient(customer)
+	hub.AddClient(agent)
+	room := hub.CreateRoom(customer, "")
+	hub.AddMessage(room, ChatMessage{Type: "message", RoomID: room.ID, From: "Alice", Content: "Olá"})
+	hub.JoinRoom(room.ID, agent)
+
+	restarted, err := NewHub(store, NewLocalBus())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := restarted.GetClient(customer.Token); !ok {
+		t.Fatal("expected customer token to survive restart")
+	}
+	got, ok := restarted.GetRoom(room.ID)
+	if !ok {
+		t.Fatal("expected room to survive restart")
+	}
+	if got.Status != RoomActive || got.Agent == nil || got.Agent.Token != agent.Token {
+		t.Errorf("expected active room with agent Bob, got %s / %v", got.Status, got.Agent)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Content != "Olá" {
+		t.Errorf("expected 1 restored message, got %v", got.Messages)
+	}
+}
+
+func TestHubRecordsTransitions(t *testing.T) {
+	store := NewMemoryStore()
+	hub, _ := NewHub(store, NewLocalBus())
 	customer := NewClient("Alice", "")
 	agent := NewClient("Bob", "en")
+	room := hub.CreateRoom(customer, "")
 
-	room := hub.CreateRoom(customer)
 	hub.JoinRoom(room.ID, agent)
+	hub.LeaveRoom(room)
+	hub.ReopenRoom(room)
 
-	if !hub.IsAgentInRoom(agent.Token) {
-		t.Fatal("expected agent to be in room")
+	transitions := store.Transitions(room.ID)
+	want := []RoomStatus{RoomActive, RoomClosing, RoomWaiting}
+	if len(transitions) != len(want) {
+		t.Fatalf("expected %d transitions, got %d", len(want), len(transitions))
 	}
-	if hub.IsAgentInRoom("fake-token") {
-		t.Fatal("expected fake token to not be in room")
+	for i, status := range want {
+		if transitions[i].To != status {
+			t.Errorf("transition %d: expected %s, got %s", i, status, transitions[i].To)
+		}
 	}
 }
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// isoLanguages maps every ISO 639-1 code to its English name.
+var isoLanguages = map[string]string{
+	"aa": "Afar", "ab": "Abkhazian", "ae": "Avestan", "af": "Afrikaans", "ak": "Akan",
+	"am": "Amharic", "an": "Aragonese", "ar": "Arabic", "as": "Assamese", "av": "Avaric",
+	"ay": "Aymara", "az": "Azerbaijani", "ba": "Bashkir", "be": "Belarusian", "bg": "Bulgarian",
+	"bi": "Bislama", "bm": "Bambara", "bn": "Bengali", "bo": "Tibetan", "br": "Breton",
+	"bs": "Bosnian", "ca": "Catalan", "ce": "Chechen", "ch": "Chamorro", "co": "Corsican",
+	"cr": "Cree", "cs": "Czech", "cu": "Church Slavic", "cv": "Chuvash", "cy": "Welsh",
+	"da": "Danish", "de": "German", "dv": "Divehi", "dz": "Dzongkha", "ee": "Ewe",
+	"el": "Greek", "en": "English", "eo": "Esperanto", "es": "Spanish", "et": "Estonian",
+	"eu": "Basque", "fa": "Persian", "ff": "Fulah", "fi": "Finnish", "fj": "Fijian",
+	"fo": "Faroese", "fr": "French", "fy": "Western Frisian", "ga": "Irish", "gd": "Scottish Gaelic",
+	"gl": "Galician", "gn": "Guarani", "gu": "Gujarati", "gv": "Manx", "ha": "Hausa",
+	"he": "Hebrew", "hi": "Hindi", "ho": "Hiri Motu", "hr": "Croatian", "ht": "Haitian",
+	"hu": "Hungarian", "hy": "Armenian", "hz": "Herero", "ia": "Interlingua", "id": "Indonesian",
+	"ie": "Interlingue", "ig": "Igbo", "ii": "Sichuan Yi", "ik": "Inupiaq", "io": "Ido",
+	"is": "Icelandic", "it": "Italian", "iu": "Inuktitut", "ja": "Japanese", "jv": "Javanese",
+	"ka": "Georgian", "kg": "Kongo", "ki": "Kikuyu", "kj": "Kuanyama", "kk": "Kazakh",
+	"kl": "Kalaallisut", "km": "Khmer", "kn": "Kannada", "ko": "Korean", "kr": "Kanuri",
+	"ks": "Kashmiri", "ku": "Kurdish", "kv": "Komi", "kw": "Cornish", "ky": "Kyrgyz",
+	"la": "Latin", "lb": "Luxembourgish", "lg": "Ganda", "li": "Limburgish", "ln": "Lingala",
+	"lo": "Lao", "lt": "Lithuanian", "lu": "Luba-Katanga", "lv": "Latvian", "mg": "Malagasy",
+	"mh": "Marshallese", "mi": "Maori", "mk": "Macedonian", "ml": "Malayalam", "mn": "Mongolian",
+	"mr": "Marathi", "ms": "Malay", "mt": "Maltese", "my": "Burmese", "na": "Nauru",
+	"nb": "Norwegian Bokmal", "nd": "North Ndebele", "ne": "Nepali", "ng": "Ndonga", "nl": "Dutch",
+	"nn": "Norwegian Nynorsk", "no": "Norwegian", "nr": "South Ndebele", "nv": "Navajo", "ny": "Chichewa",
+	"oc": "Occitan", "oj": "Ojibwa", "om": "Oromo", "or": "Oriya", "os": "Ossetian",
+	"pa": "Punjabi", "pi": "Pali", "pl": "Polish", "ps": "Pashto", "pt": "Portuguese",
+	"qu": "Quechua", "rm": "Romansh", "rn": "Rundi", "ro": "Romanian", "ru": "Russian",
+	"rw": "Kinyarwanda", "sa": "Sanskrit", "sc": "Sardinian", "sd": "Sindhi", "se": "Northern Sami",
+	"sg": "Sango", "si": "Sinhala", "sk": "Slovak", "sl": "Slovenian", "sm": "Samoan",
+	"sn": "Shona", "so": "Somali", "sq": "Albanian", "sr": "Serbian", "ss": "Swati",
+	"st": "Southern Sotho", "su": "Sundanese", "sv": "Swedish", "sw": "Swahili", "ta": "Tamil",
+	"te": "Telugu", "tg": "Tajik", "th": "Thai", "ti": "Tigrinya", "tk": "Turkmen",
+	"tl": "Tagalog", "tn": "Tswana", "to": "Tonga", "tr": "Turkish", "ts": "Tsonga",
+	"tt": "Tatar", "tw": "Twi", "ty": "Tahitian", "ug": "Uyghur", "uk": "Ukrainian",
+	"ur": "Urdu", "uz": "Uzbek", "ve": "Venda", "vi": "Vietnamese", "vo": "Volapuk",
+	"wa": "Walloon", "wo": "Wolof", "xh": "Xhosa", "yi": "Yiddish", "yo": "Yoruba",
+	"za": "Zhuang", "zh": "Chinese", "zu": "Zulu",
+}
+
+// iso639Alpha3 maps the three-letter codes backends sometimes answer with
+// (ISO 639-2/T and /B, plus 639-3 where they differ) to ISO 639-1.
+var iso639Alpha3 = map[string]string{
+	"ara": "ar", "ben": "bn", "bul": "bg", "cat": "ca", "ces": "cs", "cze": "cs",
+	"cmn": "zh", "chi": "zh", "zho": "zh", "dan": "da", "deu": "de", "ger": "de",
+	"ell": "el", "gre": "el", "eng": "en", "est": "et", "fas": "fa", "per": "fa",
+	"fin": "fi", "fra": "fr", "fre": "fr", "heb": "he", "hin": "hi", "hrv": "hr",
+	"hun": "hu", "ind": "id", "ita": "it", "jpn": "ja", "kor": "ko", "lav": "lv",
+	"lit": "lt", "msa": "ms", "may": "ms", "nld": "nl", "dut": "nl", "nor": "no",
+	"nob": "nb", "nno": "nn", "pol": "pl", "por": "pt", "ron": "ro", "rum": "ro",
+	"rus": "ru", "slk": "sk", "slo": "sk", "slv": "sl", "spa": "es", "srp": "sr",
+	"swe": "sv", "tgl": "tl", "fil": "tl", "tha": "th", "tur": "tr", "ukr": "uk",
+	"urd": "ur", "vie": "vi",
+}
+
+// languageNames maps lowercase language names, English and a few common
+// endonyms, to ISO 639-1, for backends that answer "Portuguese." instead
+// of a code.
+var languageNames = func() map[string]string {
+	names := map[string]string{
+		"português": "pt", "portugues": "pt", "español": "es", "espanol": "es",
+		"castellano": "es", "français": "fr", "francais": "fr", "deutsch": "de",
+		"italiano": "it", "nederlands": "nl", "polski": "pl", "türkçe": "tr",
+		"svenska": "sv", "farsi": "fa", "mandarin": "zh", "filipino": "tl",
+	}
+	for code, name := range isoLanguages {
+		names[strings.ToLower(name)] = code
+	}
+	return names
+}()
+
+// languageTagPattern is the shape of a BCP 47 tag: a 2-3 letter language
+// subtag followed by script, region or variant subtags.
+var languageTagPattern = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{2,8})*$`)
+
+// canonicalLanguage validates a BCP 47 tag against ISO 639 and returns it
+// in canonical case with ISO 639-1 as the language ("PT_br" becomes
+// "pt-BR", "por" becomes "pt").
+func canonicalLanguage(tag string) (string, bool) {
+	if !languageTagPattern.MatchString(tag) {
+		return "", false
+	}
+	subtags := strings.Split(strings.ReplaceAll(tag, "_", "-"), "-")
+	primary := strings.ToLower(subtags[0])
+	if code, ok := iso639Alpha3[primary]; ok {
+		primary = code
+	}
+	if _, ok := isoLanguages[primary]; !ok {
+		return "", false
+	}
+	subtags[0] = primary
+	for i, subtag := range subtags[1:] {
+		switch {
+		case len(subtag) == 4 && isAlpha(subtag): // script
+			subtags[i+1] = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		case len(subtag) == 2 && isAlpha(subtag): // region
+			subtags[i+1] = strings.ToUpper(subtag)
+		default:
+			subtags[i+1] = strings.ToLower(subtag)
+		}
+	}
+	return strings.Join(subtags, "-"), true
+}
+
+// parseLanguage makes sense of a backend's answer to "what language is
+// this?". It accepts a language tag or name, possibly quoted or followed
+// by a full stop, and a sentence that names exactly one language. Anything
+// else is rejected rather than stored as a language.
+func parseLanguage(answer string) (string, bool) {
+	trimmed := strings.TrimFunc(answer, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r) || r == '`'
+	})
+	if language, ok := canonicalLanguage(trimmed); ok {
+		return language, true
+	}
+	if code, ok := languageNames[strings.ToLower(trimmed)]; ok {
+		return code, true
+	}
+
+	// Only names count inside a sentence: plenty of short words ("is",
+	// "it", "no") are also language codes.
+	found := ""
+	for _, word := range strings.FieldsFunc(strings.ToLower(answer), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		code, ok := languageNames[word]
+		if !ok {
+			continue
+		}
+		if found != "" && found != code {
+			return "", false
+		}
+		found = code
+	}
+	return found, found != ""
+}
+
+// acceptLanguage returns the most preferred language in an
+// Accept-Language header that canonicalLanguage accepts, or "" if there's
+// none.
+func acceptLanguage(header string) string {
+	best, bestQ := "", 0.0
+	for _, entry := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		language, ok := canonicalLanguage(strings.TrimSpace(tag))
+		if ok && q > bestQ {
+			best, bestQ = language, q
+		}
+	}
+	return best
+}
+
+func isAlpha(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+func TestParseLanguage(t *testing.T) {
+	for _, tc := range []struct {
+		answer string
+		want   string
+	}{
+		{"pt", "pt"},
+		{" PT\n", "pt"},
+		{"pt_br", "pt-BR"},
+		{"zh-hant-tw", "zh-Hant-TW"},
+		{"`es`", "es"},
+		{`"fr".`, "fr"},
+		{"por", "pt"},
+		{"Portuguese.", "pt"},
+		{"Español", "es"},
+		{"The text is written in German.", "de"},
+		{"Scottish Gaelic", "gd"},
+		{"xx", ""},
+		{"klingon", ""},
+		{"It could be Spanish or Portuguese.", ""},
+		{"I'm not sure what language this is.", ""},
+		{"", ""},
+	} {
+		got, ok := parseLanguage(tc.answer)
+		if got != tc.want || ok != (tc.want != "") {
+			t.Errorf("parseLanguage(%q) = %q, %v; want %q", tc.answer, got, ok, tc.want)
+		}
+	}
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		want   string
+	}{
+		{"pt-BR,pt;q=0.9,en;q=0.8", "pt-BR"},
+		{"en;q=0.5, es-ES;q=0.9", "es-ES"},
+		{"*, fr;q=0.4", "fr"},
+		{"xx, de;q=0", ""},
+		{"", ""},
+	} {
+		if got := acceptLanguage(tc.header); got != tc.want {
+			t.Errorf("acceptLanguage(%q) = %q, want %q", tc.header, got, tc.want)
+		}
+	}
+}
+
+// startChat calls POST /start-chat and returns the response recorder.
+func startChat(t *testing.T, hub *Hub, body string, acceptLanguage string) *httptest.ResponseRecorder {
+	t.Helper()
+	translator := NewTranslator(NewFakeProvider(), NewTranslationCache(CacheOptions{TTL: time.Minute}))
+	req := httptest.NewRequest(http.MethodPost, "/start-chat", strings.NewReader(body))
+	if acceptLanguage != "" {
+		req.Header.Set("Accept-Language", acceptLanguage)
+	}
+	rec := httptest.NewRecorder()
+	handleStartChat(hub, translator, testAuth)(rec, req)
+	return rec
+}
+
+func TestStartChatLanguage(t *testing.T) {
+	hub := newTestHub(t)
+	for _, tc := range []struct {
+		name           string
+		body           string
+		acceptLanguage string
+		language       string
+		source         LanguageSource
+	}{
+		{"declared", `{"name":"Alice","content":"Hi there","language":"pt_br"}`, "en-US", "pt-BR", LanguageDeclared},
+		{"browser when unsure", `{"name":"Carla","content":"obrigado"}`, "es-ES,es;q=0.9", "es-ES", LanguageBrowser},
+		{"detected when sure", `{"name":"Dora","content":"Olá, o meu cartão foi recusado ontem e não sei porquê"}`, "en-US", "pt", LanguageDetected},
+	} {
+		rec := startChat(t, hub, tc.body, tc.acceptLanguage)
+		var started StartChatResponse
+		json.NewDecoder(rec.Body).Decode(&started)
+		room, ok := hub.GetRoom(started.RoomID)
+		if !ok {
+			t.Fatalf("%s: expected a room, got %d: %s", tc.name, rec.Code, rec.Body)
+		}
+		if room.Customer.Language != tc.language || room.Customer.LanguageSource != tc.source {
+			t.Errorf("%s: expected %s (%s), got %s (%s)", tc.name, tc.language, tc.source, room.Customer.Language, room.Customer.LanguageSource)
+		}
+	}
+
+	if rec := startChat(t, hub, `{"name":"Eve","content":"Hi","language":"klingon"}`, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid language to be refused, got %d", rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	handleRooms(hub)(rec, httptest.NewRequest(http.MethodGet, "/rooms", nil))
+	var rooms []map[string]any
+	json.NewDecoder(rec.Body).Decode(&rooms)
+	sources := map[any]any{}
+	for _, room := range rooms {
+		sources[room["customer_name"]] = room["language_source"]
+	}
+	if sources["Alice"] != "declared" || sources["Dora"] != "detected" {
+		t.Errorf("expected /rooms to show how each language was chosen, got %v", sources)
+	}
+}
+
+func TestSetLanguageRetranslatesRecentHistory(t *testing.T) {
+	hub := newTestHub(t)
+	var started StartChatResponse
+	json.NewDecoder(startChat(t, hub, `{"name":"Alice","content":"Olá, o meu cartão foi recusado ontem e não sei porquê"}`, "").Body).Decode(&started)
+	room, _ := hub.GetRoom(started.RoomID)
+	customer := room.Customer
+	agent := newTestAgent(hub)
+	hub.JoinRoom(room.ID, agent)
+	help := hub.AddMessage(room, ChatMessage{Type: "message", RoomID: room.ID, From: "Bob", SenderID: agent.ID(), Content: "How can I help?", Language: "en"})
+
+	conn, read := dialSocket(t, hub, "/ws?room_id="+room.ID, started.Token)
+	ctx := context.Background()
+	conn.Write(ctx, websocket.MessageText, []byte(`{"type":"set_language","language":"xx"}`))
+	if frame := read(); frame["type"] != "error" || frame["code"] != string(CodeInvalidPayload) {
+		t.Fatalf("expected an invalid language to be refused, got %v", frame)
+	}
+
+	conn.Write(ctx, websocket.MessageText, []byte(`{"type":"set_language","language":"ES","ref":"l1"}`))
+	if frame := read(); frame["type"] != "language_changed" || frame["language"] != "es" || frame["source"] != "declared" || frame["ref"] != "l1" {
+		t.Fatalf("expected language_changed to es, got %v", frame)
+	}
+	// The customer's own message isn't re-sent; the agent's comes back in Spanish.
+	if frame := read(); frame["id"] != help.ID || frame["content"] != "[es] How can I help?" {
+		t.Errorf("expected the agent's message in Spanish, got %v", frame)
+	}
+
+	// Detection no longer moves a declared language.
+	portuguese := Detection{Language: "pt", Confidence: 0.99}
+	if hub.ObserveLanguage(customer, portuguese) || hub.ObserveLanguage(customer, portuguese) || customer.Language != "es" {
+		t.Errorf("expected the declared language to stick, got %s", customer.Language)
+	}
+}
+
+func TestRetranslateUsesLanguageWhenQueued(t *testing.T) {
+	hub := newTestHub(t)
+	pipeline := NewPipeline(hub, NewTranslator(NewFakeProvider(), NewTranslationCache(CacheOptions{TTL: time.Minute})))
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	alice := room.Customer
+	hub.AddMessage(room, ChatMessage{Type: "message", RoomID: room.ID, From: "Bob", SenderID: bob.ID(), Content: "How can I help?", Language: "en"})
+	frames := captureFrames(t, hub, alice)
+
+	// Alice changes her mind while the room is busy; each re-send is in
+	// the language she'd picked when it was queued.
+	release := make(chan struct{})
+	pipeline.Submit(room, func(ctx context.Context) { <-release })
+	for _, language := range []string{"es", "fr"} {
+		hub.DeclareLanguage(alice, language)
+		pipeline.Retranslate(room, alice)
+	}
+	close(release)
+	for _, want := range []string{"[es] How can I help?", "[fr] How can I help?"} {
+		if msg := receive(t, frames); msg.Content != want {
+			t.Errorf("expected %q, got %q", want, msg.Content)
+		}
+	}
+}
+
+func TestSetProfileValidatesLanguages(t *testing.T) {
+	hub := newTestHub(t)
+	agent := newTestAgent(hub)
+	token := signedToken(t, agent)
+	setProfile := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/set-profile", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		testAuth.Require(hub, RoleAgent, handleSetProfile(hub))(rec, req)
+		return rec
+	}
+
+	for _, body := range []string{`{"language":"klingon"}`, `{"languages":["es","xx"]}`} {
+		if rec := setProfile(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, rec.Code)
+		}
+	}
+	if profile := hub.Profile(agent); profile.Language != "en" || profile.Languages != nil {
+		t.Errorf("expected a refused profile to change nothing, got %+v", profile)
+	}
+
+	rec := setProfile(`{"language":"PT_br","languages":["spa"]}`)
+	var resp SetProfileResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp.Language != "pt-BR" || len(resp.Languages) != 1 || resp.Languages[0] != "es" {
+		t.Errorf("expected canonical languages, got %d %+v", rec.Code, resp)
+	}
+}
@@ -13,11 +13,137 @@ import (
 	"time"
 )
 
+func newStoreFromConfig(cfg Config) (Store, error) {
+	if cfg.DatabasePath == "" {
+		return NewMemoryStore(), nil
+	}
+	return NewSQLiteStore(cfg.DatabasePath)
+}
+
+func newBusFromConfig(cfg Config) (Bus, error) {
+	if cfg.RedisAddr == "" {
+		return NewLocalBus(), nil
+	}
+	return NewRedisBus(cfg.RedisAddr)
+}
+
+func newCacheFromConfig(cfg Config) (*TranslationCache, error) {
+	opts := CacheOptions{
+		TTL:          cfg.CacheTTL,
+		MaxEntries:   cfg.CacheMaxEntries,
+		MaxBytes:     cfg.CacheMaxBytes,
+		JanitorEvery: cfg.CacheJanitorEvery,
+	}
+	if cfg.CachePath != "" {
+		store, err := NewBoltCacheStore(cfg.CachePath)
+		if err != nil {
+			return nil, err
+		}
+		opts.Store = store
+	}
+	return NewTranslationCache(opts), nil
+}
+
+// newAuthenticatorFromConfig signs with AUTH_SECRET. Without one a random
+// secret is used, so tokens stop working on restart and can't be shared
+// between instances.
+func newAuthenticatorFromConfig(cfg Config, store Store) (*Authenticator, error) {
+	secret := []byte(cfg.AuthSecret)
+	if len(secret) == 0 {
+		slog.Warn("AUTH_SECRET not set, using a random secret; tokens won't survive a restart")
+		secret = []byte(generateToken() + generateToken())
+	}
+	var seed []Account
+	if cfg.AccountsFile != "" {
+		accounts, err := loadAccountsFile(cfg.AccountsFile)
+		if err != nil {
+			return nil, err
+		}
+		seed = accounts
+	}
+	return NewAuthenticator(secret, cfg.AuthTokenTTL, store, seed)
+}
+
+// hashPasswordCommand prints a hash for ACCOUNTS_FILE:
+//
+//	go run . hash-password <password>
+func hashPasswordCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: hash-password <password>")
+		os.Exit(2)
+	}
+	hash, err := hashPassword(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(hash)
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+		hashPasswordCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		schemaCommand()
+		return
+	}
+
 	cfg := LoadConfig()
-	hub := NewHub()
-	translator := NewTranslator(cfg.OllamaURL, cfg.OllamaModel, cfg.CacheTTL)
+	store, err := newStoreFromConfig(cfg)
+	if err != nil {
+		slog.Error("failed to open store", "error", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	bus, err := newBusFromConfig(cfg)
+	if err != nil {
+		slog.Error("failed to connect message bus", "error", err)
+		os.Exit(1)
+	}
+	defer bus.Close()
+	hub, err := NewHub(store, bus)
+	if err != nil {
+		slog.Error("failed to restore hub", "error", err)
+		os.Exit(1)
+	}
+	overflow, err := parseOverflowPolicy(cfg.SlowConsumer)
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+	hub.Outbound = OutboxOptions{
+		QueueSize:    cfg.SendQueueSize,
+		Overflow:     overflow,
+		WriteTimeout: cfg.WriteTimeout,
+		PingInterval: cfg.PingInterval,
+	}
+	providers, err := NewProviderChainFromConfig(cfg)
+	if err != nil {
+		slog.Error("invalid translation provider", "error", err)
+		os.Exit(1)
+	}
+	cache, err := newCacheFromConfig(cfg)
+	if err != nil {
+		slog.Error("failed to open translation cache", "error", err)
+		os.Exit(1)
+	}
+	defer cache.Close()
+	auth, err := newAuthenticatorFromConfig(cfg, store)
+	if err != nil {
+		slog.Error("failed to load accounts", "error", err)
+		os.Exit(1)
+	}
+	sockets := NewSocketAuth(auth, hub, cfg.AllowedOrigins)
+	translator := NewTranslator(providers, cache)
+	translator.SetMaxConcurrent(cfg.TranslationConcurrency)
+	pipeline := NewPipeline(hub, translator)
+	pipeline.SetMaxQueued(cfg.PipelineQueueSize)
 	limiter := NewRateLimiter(cfg.RateLimit, cfg.RateLimitWindow)
+	sweepCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	go hub.RunSweeper(sweepCtx, cfg.ClientSweepEvery, cfg.ClientIdleTimeout)
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, _ = fmt.Fprint(w, "Server is running")
@@ -26,25 +152,41 @@ func main() {
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{
-			"status":  "ok",
-			"clients": len(hub.Clients),
-			"rooms":   len(hub.Rooms),
+			"status":   "ok",
+			"clients":  len(hub.Clients),
+			"rooms":    len(hub.Rooms),
+			"provider": providers.Active(),
+			"breakers": providers.Status(),
+			"cache":    translator.CacheStats(),
+			"pipeline": pipeline.Stats(),
 		})
 	})
 
-	http.HandleFunc("/start-chat", handleStartChat(hub))
-	http.HandleFunc("/set-profile", handleSetProfile(hub))
-	http.HandleFunc("/rooms", handleRooms(hub))
-	http.HandleFunc("/join-room", handleJoinRoom(hub))
-	http.HandleFunc("/end-chat", handleEndChat(hub))
-	http.HandleFunc("/ws", handleWebSocket(hub, translator, limiter))
+	http.HandleFunc("/start-chat", handleStartChat(hub, translator, auth))
+	http.HandleFunc("/resume", handleResume(hub, auth))
+	http.HandleFunc("/login", handleLogin(hub, auth, cfg.AgentMaxRooms))
+	http.HandleFunc("/refresh", auth.Require(hub, RoleCustomer, handleRefresh(auth)))
+	http.HandleFunc("/logout", auth.Require(hub, RoleCustomer, handleLogout(hub, auth)))
+	http.HandleFunc("/ws-ticket", auth.Require(hub, RoleCustomer, handleTicket(auth)))
+	http.HandleFunc("/accounts", auth.Require(hub, RoleAdmin, handleCreateAccount(auth)))
+	http.HandleFunc("/set-profile", auth.Require(hub, RoleAgent, handleSetProfile(hub)))
+	http.HandleFunc("/rooms", auth.Require(hub, RoleAgent, handleRooms(hub)))
+	http.HandleFunc("/join-room", auth.Require(hub, RoleAgent, handleJoinRoom(hub)))
+	http.HandleFunc("/end-chat", auth.Require(hub, RoleCustomer, handleEndChat(hub)))
+	http.HandleFunc("/availability", auth.Require(hub, RoleAgent, handleAvailability(hub)))
+	http.HandleFunc("/agents", auth.Require(hub, RoleAgent, handleAgents(hub)))
+	http.HandleFunc("/transfer", auth.Require(hub, RoleAgent, handleTransfer(hub)))
+	http.HandleFunc("/invite", auth.Require(hub, RoleAgent, handleInvite(hub)))
+	http.HandleFunc("/agent-ws", handleAgentWebSocket(hub, pipeline, limiter, sockets))
+	http.HandleFunc("/supervisor-ws", handleSupervisorWebSocket(hub, pipeline, limiter, sockets))
+	http.HandleFunc("/ws", handleWebSocket(hub, pipeline, limiter, sockets))
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 
 	srv := &http.Server{Addr: cfg.Port}
 
 	// Start server in a goroutine
 	go func() {
-		slog.Info("server started", "port", cfg.Port, "model", cfg.OllamaModel)
+		slog.Info("server started", "port", cfg.Port, "providers", providers.Name())
 		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			slog.Error("server error", "error", err)
 			os.Exit(1)
@@ -1,17 +1,64 @@
 package main
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // --- REST request bodies ---
 
 // StartChatRequest is sent by a customer to POST /start-chat.
 type StartChatRequest struct {
 	Name    string `json:"name"`
 	Content string `json:"content"`
+	Topic   string `json:"topic,omitempty"`
+	// Language is the customer's preferred language as a BCP 47 tag.
+	// Without it the language is detected from Content, falling back to
+	// the Accept-Language header.
+	Language string `json:"language,omitempty"`
+}
+
+// LoginRequest is sent by staff to POST /login.
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LoginResponse carries the signed token staff send as a bearer token. It
+// is also returned from POST /refresh.
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	Role      Role      `json:"role"`
+	Name      string    `json:"name"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateAccountRequest is sent by an admin to POST /accounts.
+type CreateAccountRequest struct {
+	Username  string   `json:"username"`
+	Password  string   `json:"password"`
+	Role      Role     `json:"role"`
+	Name      string   `json:"name"`
+	Language  string   `json:"language"`
+	Languages []string `json:"languages,omitempty"`
+	Skills    []string `json:"skills,omitempty"`
+	MaxRooms  int      `json:"max_rooms,omitempty"`
 }
 
-// SetProfileRequest is sent by an agent to POST /set-profile.
+// SetProfileRequest is sent by logged-in staff to POST /set-profile.
 type SetProfileRequest struct {
-	Name     string `json:"name"`
-	Language string `json:"language"`
+	Name      string   `json:"name"`
+	Language  string   `json:"language"`
+	Languages []string `json:"languages,omitempty"`
+	Skills    []string `json:"skills,omitempty"`
+	// MaxRooms is how many chats the agent takes at once; 0 uses the
+	// server default (AGENT_MAX_ROOMS).
+	MaxRooms int `json:"max_rooms,omitempty"`
+}
+
+// AvailabilityRequest is sent by an agent to POST /availability.
+type AvailabilityRequest struct {
+	Available bool `json:"available"`
 }
 
 // RoomRequest is used for POST /join-room and POST /end-chat.
@@ -23,24 +70,121 @@ type RoomRequest struct {
 
 // StartChatResponse is returned from POST /start-chat.
 type StartChatResponse struct {
-	Token  string `json:"token"`
-	RoomID string `json:"room_id"`
+	Token     string    `json:"token"`
+	RoomID    string    `json:"room_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// ResumeToken outlives a page reload: keep it (e.g. in localStorage)
+	// and trade it at POST /resume for a new token to the same room.
+	ResumeToken string `json:"resume_token"`
+	ClientID    string `json:"client_id"`
 }
 
-// SetProfileResponse is returned from POST /set-profile.
+// ResumeRequest is sent by a returning customer to POST /resume.
+type ResumeRequest struct {
+	ResumeToken string `json:"resume_token"`
+}
+
+// ResumeResponse reattaches a customer to their open room.
+type ResumeResponse struct {
+	Token     string     `json:"token"`
+	RoomID    string     `json:"room_id"`
+	Status    RoomStatus `json:"status"`
+	Name      string     `json:"name"`
+	ClientID  string     `json:"client_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+// SetProfileResponse echoes the profile after POST /set-profile.
 type SetProfileResponse struct {
-	Token string `json:"token"`
+	Name      string   `json:"name"`
+	Language  string   `json:"language"`
+	Languages []string `json:"languages,omitempty"`
+	Skills    []string `json:"skills,omitempty"`
+	MaxRooms  int      `json:"max_rooms"`
+}
+
+// TicketResponse is returned from POST /ws-ticket.
+type TicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 // --- WebSocket messages ---
 
+// Envelope wraps every frame, in both directions, on a socket that
+// negotiated the chat.v1 subprotocol. Payload is the frame itself, one of
+// the types below as listed in static/protocol.schema.json. On a client
+// frame ID is an optional correlation ID; the "sent" event or error
+// answering that frame carries it back. Sockets on the legacy "chat"
+// subprotocol send and receive bare payloads.
+type Envelope struct {
+	V       int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// AuthFrame is the first frame of a socket that connected without a
+// credential. The server answers with type "authenticated".
+type AuthFrame struct {
+	Type  string `json:"type"`
+	Token string `json:"token,omitempty"`
+}
+
 // ChatMessage is sent to deliver a message to the other participant.
 type ChatMessage struct {
-	Type              string `json:"type"`
-	RoomID            string `json:"room_id"`
-	From              string `json:"from"`
+	Type string `json:"type"`
+	// ID, Seq and SentAt are assigned by the server when the message is
+	// recorded. Seq counts up from 1 within a room, so clients can order
+	// and dedupe by it.
+	ID     string    `json:"id,omitempty"`
+	Seq    int64     `json:"seq,omitempty"`
+	SentAt time.Time `json:"sent_at,omitzero"`
+	RoomID string    `json:"room_id"`
+	From   string    `json:"from"`
+	// SenderID is the sender's public Client.ID, so a client can tell its
+	// own messages apart in a replayed transcript.
+	SenderID          string `json:"sender_id,omitempty"`
 	Content           string `json:"content"`
 	TranslatedContent string `json:"translated_content,omitempty"`
+	// Language is what Content was written in, kept in history so a
+	// transcript can be translated for whoever reads it later.
+	Language string `json:"language,omitempty"`
+	// Receipts tracks delivery to each recipient, keyed by Client.ID.
+	Receipts map[string]Receipt `json:"receipts,omitempty"`
+}
+
+// SentEvent confirms to the sender that their message was recorded. Ref
+// echoes the ref they sent it with, so they can match it to the message
+// they displayed and learn its ID for receipts.
+type SentEvent struct {
+	Type   string    `json:"type"`
+	RoomID string    `json:"room_id"`
+	Ref    string    `json:"ref,omitempty"`
+	ID     string    `json:"id"`
+	Seq    int64     `json:"seq"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// ReceiptEvent tells a message's sender that a recipient's socket got it
+// (Status "delivered") or that they read it.
+type ReceiptEvent struct {
+	Type     string        `json:"type"`
+	RoomID   string        `json:"room_id"`
+	ID       string        `json:"id"`
+	ClientID string        `json:"client_id"`
+	Status   ReceiptStatus `json:"status"`
+	At       time.Time     `json:"at"`
+}
+
+// MessageDelta carries a chunk of a translation as it streams in. Deltas
+// share the ID of the final ChatMessage that follows them.
+type MessageDelta struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	RoomID string `json:"room_id"`
+	From   string `json:"from"`
+	Delta  string `json:"delta"`
 }
 
 // RoomJoinedResponse is sent over WebSocket when an agent joins a room.
@@ -49,6 +193,68 @@ type RoomJoinedResponse struct {
 	RoomID string `json:"room_id"`
 }
 
+// AssignedEvent is sent over the agent's /agent-ws socket when the queue
+// hands them a room.
+type AssignedEvent struct {
+	Type         string `json:"type"`
+	RoomID       string `json:"room_id"`
+	CustomerName string `json:"customer_name"`
+	// CustomerID matches the client_id of the customer's receipts.
+	CustomerID string `json:"customer_id"`
+	Language   string `json:"language"`
+	Topic      string `json:"topic,omitempty"`
+	// TransferredFrom and Note are set when another agent handed the room
+	// over; the note is private to agents.
+	TransferredFrom string `json:"transferred_from,omitempty"`
+	Note            string `json:"note,omitempty"`
+	// InvitedBy is set on "invited" events, sent when the room's agent
+	// brings another staff member into the conversation.
+	InvitedBy string `json:"invited_by,omitempty"`
+}
+
+// InviteRequest brings another staff member (AgentID, from GET /agents)
+// into a room alongside its agent.
+type InviteRequest struct {
+	RoomID  string `json:"room_id"`
+	AgentID string `json:"agent_id"`
+	Note    string `json:"note,omitempty"`
+}
+
+// TransferRequest hands a room to another agent (AgentID, from GET
+// /agents) or, when AgentID is empty, back to the queue, optionally under
+// a new Topic.
+type TransferRequest struct {
+	RoomID  string `json:"room_id"`
+	AgentID string `json:"agent_id,omitempty"`
+	Topic   string `json:"topic,omitempty"`
+	Note    string `json:"note,omitempty"`
+}
+
+type InviteResponse struct {
+	RoomID    string `json:"room_id"`
+	AgentName string `json:"agent_name"`
+}
+
+// TransferredEvent tells the customer their chat moved. AgentName is empty
+// while they wait in the queue for the next agent.
+type TransferredEvent struct {
+	Type      string `json:"type"`
+	RoomID    string `json:"room_id"`
+	AgentName string `json:"agent_name,omitempty"`
+}
+
+// AgentInfo describes an available agent for transfers. ID is safe to
+// share; tokens are credentials.
+type AgentInfo struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Language  string   `json:"language"`
+	Languages []string `json:"languages,omitempty"`
+	Skills    []string `json:"skills,omitempty"`
+	Rooms     int      `json:"rooms"`
+	MaxRooms  int      `json:"max_rooms"`
+}
+
 // ChatEndedResponse is sent over WebSocket when a chat ends.
 type ChatEndedResponse struct {
 	Type   string `json:"type"`
@@ -56,8 +262,88 @@ type ChatEndedResponse struct {
 	Reason string `json:"reason"`
 }
 
-// ErrorResponse is sent when something goes wrong.
+// ErrorCode tells clients what went wrong without parsing Message.
+type ErrorCode string
+
+const (
+	CodeInvalidPayload     ErrorCode = "invalid_payload"
+	CodeUnsupportedVersion ErrorCode = "unsupported_version"
+	CodeRateLimited        ErrorCode = "rate_limited"
+	CodeRoomClosed         ErrorCode = "room_closed"
+	CodeNotFound           ErrorCode = "not_found"
+	CodeForbidden          ErrorCode = "forbidden"
+	// CodeTranslationFailed means the message was delivered, but some
+	// recipients got the original because translating it failed.
+	CodeTranslationFailed ErrorCode = "translation_failed"
+)
+
+// ErrorResponse is sent when something goes wrong. Ref is the ref of the
+// frame that caused it, if it had one.
 type ErrorResponse struct {
-	Type    string `json:"type"`
-	Message string `json:"message"`
+	Type    string    `json:"type"`
+	Code    ErrorCode `json:"code"`
+	RoomID  string    `json:"room_id,omitempty"`
+	Ref     string    `json:"ref,omitempty"`
+	Message string    `json:"message"`
+}
+
+// ClientFrame is every frame a client sends over a WebSocket. Type is one
+// of:
+//
+//   - "message" (the default): Content, answered with a "sent" event
+//     carrying Ref
+//   - "typing_start", "typing_stop": relayed untranslated to the room
+//   - "delivered", "read": acknowledge the message ID
+//   - "history": replay the room's transcript (staff)
+//   - "set_language": Language, answered with a "language_changed" event
+//     carrying Ref; recent messages are then re-sent in it
+//   - "watch" with Mode, "leave": supervisors only
+//
+// /agent-ws and /supervisor-ws carry all of a client's rooms, so their
+// frames name RoomID; on /ws the room comes from the URL.
+type ClientFrame struct {
+	Type    string          `json:"type,omitempty"`
+	RoomID  string          `json:"room_id,omitempty"`
+	ID      string          `json:"id,omitempty"`
+	Ref     string          `json:"ref,omitempty"`
+	Content string          `json:"content,omitempty"`
+	Mode    ParticipantMode `json:"mode,omitempty"`
+	// Language is the BCP 47 tag a set_language frame switches to.
+	Language string `json:"language,omitempty"`
+}
+
+// TypingEvent relays a typing_start or typing_stop to the rest of a room.
+type TypingEvent struct {
+	Type     string `json:"type"`
+	RoomID   string `json:"room_id"`
+	From     string `json:"from"`
+	SenderID string `json:"sender_id"`
+}
+
+// PresenceEvent tells a room that one of its members' sockets came up
+// ("participant_connected") or went away ("participant_disconnected").
+type PresenceEvent struct {
+	Type     string `json:"type"`
+	RoomID   string `json:"room_id"`
+	ClientID string `json:"client_id"`
+	Name     string `json:"name"`
+	Role     Role   `json:"role"`
+}
+
+// LanguageChangedEvent confirms a set_language frame. The room's recent
+// messages follow, translated into the new language, with their original
+// IDs so the page can replace them.
+type LanguageChangedEvent struct {
+	Type     string         `json:"type"`
+	RoomID   string         `json:"room_id"`
+	Ref      string         `json:"ref,omitempty"`
+	Language string         `json:"language"`
+	Source   LanguageSource `json:"source"`
+}
+
+// WatchingEvent confirms a supervisor's mode in a room.
+type WatchingEvent struct {
+	Type   string          `json:"type"`
+	RoomID string          `json:"room_id"`
+	Mode   ParticipantMode `json:"mode"`
 }
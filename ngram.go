@@ -0,0 +1,231 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Local language detection. Text in a script only one language we know
+// uses (Hangul, kana, Thai, ...) is identified by its script; Latin text
+// is scored against trigram profiles of the languages customers most
+// often write in. Both give a confidence between 0 and 1 that stays low
+// for short or mixed text, so the caller knows when to ask the backend.
+
+// ngramFullLength is how many trigrams a text needs before its confidence
+// is no longer discounted for being short.
+const ngramFullLength = 40
+
+// ngramFullCoverage is the share of a text's trigrams the winning profile
+// must know before its confidence is no longer discounted. The profiles
+// only cover a few languages, and text in any other still has a "best"
+// one; few familiar trigrams give that away.
+const ngramFullCoverage = 0.6
+
+// scriptLanguages are the scripts that identify a language, with how sure
+// the script alone makes us. Cyrillic, Arabic and Devanagari are shared by
+// several languages, so they only suggest the most common one.
+var scriptLanguages = []struct {
+	script     *unicode.RangeTable
+	language   string
+	confidence float64
+}{
+	{unicode.Hangul, "ko", 0.99},
+	{unicode.Hiragana, "ja", 0.99},
+	{unicode.Katakana, "ja", 0.99},
+	{unicode.Thai, "th", 0.99},
+	{unicode.Greek, "el", 0.97},
+	{unicode.Hebrew, "he", 0.95},
+	{unicode.Georgian, "ka", 0.99},
+	{unicode.Armenian, "hy", 0.99},
+	{unicode.Han, "zh", 0.9}, // counted separately, see detectLocal
+	{unicode.Cyrillic, "ru", 0.6},
+	{unicode.Arabic, "ar", 0.6},
+	{unicode.Devanagari, "hi", 0.7},
+}
+
+// ngramSamples is the training text behind each Latin-script profile.
+var ngramSamples = map[string]string{
+	"en": `Hello, I need some help with my order. I bought a pair of shoes last week and they still have not arrived.
+Can you tell me where my package is? The tracking number does not work on the website. I would like to change
+the delivery address because I will be away on Friday. Thank you for your help, that is very kind of you.
+Is there anything else I should do? My account says the payment was taken twice, could you please check it
+and give me a refund for the second charge? I have been waiting for an answer since yesterday morning.
+Which plan is the best for a small business with three people? How long does shipping usually take?`,
+	"pt": `Olá, preciso de ajuda com o meu pedido. Comprei um par de sapatos na semana passada e ainda não chegaram.
+Você pode me dizer onde está a minha encomenda? O código de rastreio não funciona no site. Gostaria de mudar o
+endereço de entrega porque não vou estar em casa na sexta-feira. Obrigado pela ajuda, é muito gentil da sua parte.
+Há mais alguma coisa que eu deva fazer? A minha conta diz que o pagamento foi cobrado duas vezes, pode verificar
+e devolver a segunda cobrança? Estou à espera de uma resposta desde ontem de manhã. Qual é o melhor plano para uma
+pequena empresa com três pessoas? Quanto tempo demora normalmente o envio? Não consigo entrar na minha conta.`,
+	"es": `Hola, necesito ayuda con mi pedido. Compré un par de zapatos la semana pasada y todavía no han llegado.
+¿Puede decirme dónde está mi paquete? El número de seguimiento no funciona en la página web. Me gustaría cambiar
+la dirección de entrega porque no estaré en casa el viernes. Gracias por su ayuda, es usted muy amable.
+¿Hay algo más que deba hacer? Mi cuenta dice que el pago se cobró dos veces, ¿podría revisarlo y devolverme el
+segundo cargo? Estoy esperando una respuesta desde ayer por la mañana. ¿Cuál es el mejor plan para una pequeña
+empresa de tres personas? ¿Cuánto tarda normalmente el envío? No puedo entrar en mi cuenta, la contraseña falla.`,
+	"fr": `Bonjour, j'ai besoin d'aide avec ma commande. J'ai acheté une paire de chaussures la semaine dernière et
+elles ne sont toujours pas arrivées. Pouvez-vous me dire où se trouve mon colis ? Le numéro de suivi ne fonctionne
+pas sur le site. Je voudrais changer l'adresse de livraison parce que je ne serai pas chez moi vendredi. Merci pour
+votre aide, c'est très gentil. Est-ce que je dois faire autre chose ? Mon compte indique que le paiement a été
+prélevé deux fois, pourriez-vous vérifier et me rembourser le deuxième prélèvement ? J'attends une réponse depuis
+hier matin. Quelle est la meilleure offre pour une petite entreprise de trois personnes ? Combien de temps prend
+la livraison en général ? Je n'arrive pas à me connecter à mon compte.`,
+	"de": `Hallo, ich brauche Hilfe mit meiner Bestellung. Ich habe letzte Woche ein Paar Schuhe gekauft und sie sind
+immer noch nicht angekommen. Können Sie mir sagen, wo mein Paket ist? Die Sendungsnummer funktioniert auf der
+Webseite nicht. Ich möchte die Lieferadresse ändern, weil ich am Freitag nicht zu Hause bin. Vielen Dank für Ihre
+Hilfe, das ist sehr nett. Muss ich sonst noch etwas tun? Mein Konto zeigt, dass die Zahlung zweimal abgebucht
+wurde, könnten Sie das bitte prüfen und mir die zweite Abbuchung erstatten? Ich warte seit gestern Morgen auf eine
+Antwort. Welcher Tarif ist der beste für eine kleine Firma mit drei Leuten? Wie lange dauert der Versand normalerweise?
+Ich kann mich nicht in mein Konto einloggen, das Passwort wird nicht akzeptiert.`,
+	"it": `Ciao, ho bisogno di aiuto con il mio ordine. Ho comprato un paio di scarpe la settimana scorsa e non sono
+ancora arrivate. Può dirmi dove si trova il mio pacco? Il numero di tracciamento non funziona sul sito. Vorrei
+cambiare l'indirizzo di consegna perché venerdì non sarò a casa. Grazie per l'aiuto, è molto gentile. C'è
+qualcos'altro che devo fare? Il mio conto dice che il pagamento è stato addebitato due volte, potrebbe controllare
+e rimborsarmi il secondo addebito? Aspetto una risposta da ieri mattina. Qual è il piano migliore per una piccola
+azienda di tre persone? Quanto tempo richiede di solito la spedizione? Non riesco ad accedere al mio account.`,
+	"nl": `Hallo, ik heb hulp nodig met mijn bestelling. Ik heb vorige week een paar schoenen gekocht en ze zijn nog
+steeds niet aangekomen. Kunt u mij vertellen waar mijn pakket is? Het volgnummer werkt niet op de website. Ik wil
+graag het afleveradres wijzigen omdat ik vrijdag niet thuis ben. Bedankt voor uw hulp, dat is erg vriendelijk.
+Moet ik nog iets anders doen? Mijn rekening laat zien dat de betaling twee keer is afgeschreven, kunt u dat
+controleren en de tweede afschrijving terugbetalen? Ik wacht sinds gisterochtend op een antwoord. Welk abonnement
+is het beste voor een klein bedrijf met drie mensen? Hoe lang duurt de verzending meestal? Ik kan niet inloggen.`,
+	"pl": `Dzień dobry, potrzebuję pomocy z moim zamówieniem. W zeszłym tygodniu kupiłem parę butów i nadal nie
+dotarły. Czy może mi pan powiedzieć, gdzie jest moja paczka? Numer przesyłki nie działa na stronie. Chciałbym
+zmienić adres dostawy, ponieważ w piątek nie będzie mnie w domu. Dziękuję za pomoc, to bardzo miłe. Czy muszę
+zrobić coś jeszcze? Na moim koncie widać, że płatność została pobrana dwa razy, czy mogłaby pani to sprawdzić
+i zwrócić drugą opłatę? Czekam na odpowiedź od wczoraj rano. Jaki plan jest najlepszy dla małej firmy z trzema
+osobami? Ile zwykle trwa wysyłka? Nie mogę zalogować się na swoje konto, hasło nie działa.`,
+}
+
+// ngramProfile holds the log probability of each trigram in a language,
+// with add-one smoothing; unseen is the log probability of any trigram
+// the sample didn't contain.
+type ngramProfile struct {
+	logProb map[string]float64
+	unseen  float64
+}
+
+var ngramProfiles = func() map[string]ngramProfile {
+	profiles := make(map[string]ngramProfile, len(ngramSamples))
+	for language, sample := range ngramSamples {
+		counts := make(map[string]int)
+		total := 0
+		for _, gram := range trigrams(sample) {
+			counts[gram]++
+			total++
+		}
+		denominator := float64(total + len(counts) + 1)
+		profile := ngramProfile{
+			logProb: make(map[string]float64, len(counts)),
+			unseen:  math.Log(1 / denominator),
+		}
+		for gram, n := range counts {
+			profile.logProb[gram] = math.Log(float64(n+1) / denominator)
+		}
+		profiles[language] = profile
+	}
+	return profiles
+}()
+
+// trigrams splits text into lowercase words padded with spaces and returns
+// every three-letter window, so word starts and endings count too.
+func trigrams(text string) []string {
+	var grams []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			grams = append(grams, string(runes[i:i+3]))
+		}
+	}
+	return grams
+}
+
+// detectLocal guesses text's language without calling a backend. It
+// returns a zero Detection for text with no letters.
+func detectLocal(text string) Detection {
+	var letters, latin, han int
+	counts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Han, r):
+			han++
+		default:
+			for _, s := range scriptLanguages {
+				if unicode.Is(s.script, r) {
+					counts[s.language]++
+					break
+				}
+			}
+		}
+	}
+	if letters == 0 {
+		return Detection{}
+	}
+	// Kanji alongside kana is Japanese; on its own it's Chinese.
+	if counts["ja"] > 0 {
+		counts["ja"] += han
+	} else {
+		counts["zh"] = han
+	}
+
+	best, confidence := "", 0.0
+	for _, s := range scriptLanguages {
+		n := counts[s.language]
+		if n <= latin || (best != "" && n <= counts[best]) {
+			continue
+		}
+		best, confidence = s.language, s.confidence*float64(n)/float64(letters)
+	}
+	if best == "" {
+		return detectNgram(text)
+	}
+	return Detection{Language: best, Confidence: confidence, Source: SourceLocal}
+}
+
+// detectNgram scores Latin text against every profile. Confidence is the
+// winner's posterior probability, discounted for texts shorter than
+// ngramFullLength trigrams and for trigrams the winner has never seen.
+func detectNgram(text string) Detection {
+	grams := trigrams(text)
+	if len(grams) == 0 {
+		return Detection{}
+	}
+	scores := make(map[string]float64, len(ngramProfiles))
+	best, top := "", math.Inf(-1)
+	for language, profile := range ngramProfiles {
+		score := 0.0
+		for _, gram := range grams {
+			if p, ok := profile.logProb[gram]; ok {
+				score += p
+			} else {
+				score += profile.unseen
+			}
+		}
+		scores[language] = score
+		if score > top {
+			best, top = language, score
+		}
+	}
+
+	sum := 0.0
+	for _, score := range scores {
+		sum += math.Exp(score - top)
+	}
+	seen := 0
+	for _, gram := range grams {
+		if _, ok := ngramProfiles[best].logProb[gram]; ok {
+			seen++
+		}
+	}
+	posterior := 1 / sum
+	length := min(1, float64(len(grams))/ngramFullLength)
+	coverage := min(1, float64(seen)/float64(len(grams))/ngramFullCoverage)
+	return Detection{Language: best, Confidence: posterior * length * coverage, Source: SourceLocal}
+}
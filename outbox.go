@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// statusSlowConsumer closes a socket whose outbox overflowed under
+// OverflowDisconnect. The client can reconnect and catch up from history.
+const statusSlowConsumer websocket.StatusCode = 4001
+
+var (
+	errOutboxClosed = errors.New("socket closed")
+	errSlowConsumer = errors.New("socket too slow to keep up")
+)
+
+// OverflowPolicy is what an Outbox does with a frame when its queue is
+// full.
+type OverflowPolicy string
+
+const (
+	// OverflowDisconnect closes the socket with statusSlowConsumer.
+	OverflowDisconnect OverflowPolicy = "disconnect"
+	// OverflowDropOldest discards the oldest queued frame to make room.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+)
+
+// OutboxOptions configure the writer behind every local socket. Zero
+// fields take the defaults below.
+type OutboxOptions struct {
+	QueueSize    int            // frames queued per socket; default 64
+	Overflow     OverflowPolicy // default OverflowDisconnect
+	WriteTimeout time.Duration  // per write and per ping; default 10s
+	PingInterval time.Duration  // default 30s
+}
+
+func (o OutboxOptions) withDefaults() OutboxOptions {
+	if o.QueueSize <= 0 {
+		o.QueueSize = 64
+	}
+	if o.Overflow == "" {
+		o.Overflow = OverflowDisconnect
+	}
+	if o.WriteTimeout <= 0 {
+		o.WriteTimeout = 10 * time.Second
+	}
+	if o.PingInterval <= 0 {
+		o.PingInterval = 30 * time.Second
+	}
+	return o
+}
+
+// parseOverflowPolicy checks a SLOW_CONSUMER_POLICY value.
+func parseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(s); policy {
+	case OverflowDisconnect, OverflowDropOldest:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown slow consumer policy %q (want %s or %s)", s, OverflowDisconnect, OverflowDropOldest)
+}
+
+// Outbox owns the writes to one WebSocket. Frames are queued with Send and
+// written, in order, by a single goroutine with a deadline on each write,
+// so a slow client never holds up whoever is sending to it. A second
+// goroutine pings the client; a socket that misses a pong or a write
+// deadline is dropped, and its handler's read loop ends.
+type Outbox struct {
+	conn  *websocket.Conn
+	opts  OutboxOptions
+	queue chan []byte
+	// mu serializes Send, so making room under OverflowDropOldest can't
+	// race another sender for the freed slot.
+	mu        sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+	dropped   atomic.Int64
+
+	// draining tells the writer to flush the queue and exit, which it
+	// signals by closing finished.
+	draining  chan struct{}
+	drainOnce sync.Once
+	finished  chan struct{}
+}
+
+// newOutbox starts the writer and keepalive goroutines for conn. They
+// run until the outbox is closed or the socket fails.
+func newOutbox(conn *websocket.Conn, opts OutboxOptions) *Outbox {
+	opts = opts.withDefaults()
+	o := &Outbox{
+		conn:     conn,
+		opts:     opts,
+		queue:    make(chan []byte, opts.QueueSize),
+		done:     make(chan struct{}),
+		draining: make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go o.writeLoop()
+	go o.keepAlive()
+	return o
+}
+
+// Send queues a frame for the socket without waiting for it to be written.
+// If the queue is full the overflow policy applies: under
+// OverflowDisconnect the socket is closed and Send returns
+// errSlowConsumer.
+func (o *Outbox) Send(data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for {
+		select {
+		case <-o.done:
+			return errOutboxClosed
+		case o.queue <- data:
+			return nil
+		default:
+		}
+
+		if o.opts.Overflow != OverflowDropOldest {
+			slog.Warn("disconnecting slow consumer", "queued", len(o.queue))
+			o.Close(statusSlowConsumer, "too slow to keep up")
+			return errSlowConsumer
+		}
+		select {
+		case <-o.queue:
+			slog.Warn("dropped frame for slow consumer", "dropped", o.dropped.Add(1))
+		default:
+		}
+	}
+}
+
+// Dropped reports how many frames OverflowDropOldest has discarded.
+func (o *Outbox) Dropped() int64 {
+	return o.dropped.Load()
+}
+
+// Close stops the outbox and closes the socket with code. Queued frames
+// are discarded. The close handshake runs in the background.
+func (o *Outbox) Close(code websocket.StatusCode, reason string) {
+	o.closeOnce.Do(func() {
+		close(o.done)
+		go o.conn.Close(code, reason)
+	})
+}
+
+// stop ends the outbox's goroutines, leaving the socket to its handler.
+func (o *Outbox) stop() {
+	o.closeOnce.Do(func() { close(o.done) })
+}
+
+// drain stops the outbox once the frames already queued are written,
+// waiting at most WriteTimeout, so whatever a handler sent just before
+// returning (a closed room's error, say) still reaches the client before
+// the handler closes the socket.
+func (o *Outbox) drain() {
+	o.drainOnce.Do(func() { close(o.draining) })
+	timer := time.NewTimer(o.opts.WriteTimeout)
+	defer timer.Stop()
+	select {
+	case <-o.finished:
+	case <-timer.C:
+	}
+	o.stop()
+}
+
+// abort drops a socket that failed a write or a ping.
+func (o *Outbox) abort(err error) {
+	o.closeOnce.Do(func() {
+		slog.Warn("dropping unresponsive socket", "error", err)
+		close(o.done)
+		o.conn.CloseNow()
+	})
+}
+
+func (o *Outbox) writeLoop() {
+	defer close(o.finished)
+	for {
+		select {
+		case <-o.done:
+			return
+		case <-o.draining:
+			o.flush()
+			return
+		case data := <-o.queue:
+			ctx, cancel := context.WithTimeout(context.Background(), o.opts.WriteTimeout)
+			err := writeFrame(ctx, o.conn, data)
+			cancel()
+			if err != nil {
+				o.abort(err)
+				return
+			}
+		}
+	}
+}
+
+// flush writes whatever is still queued, all within one WriteTimeout.
+func (o *Outbox) flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), o.opts.WriteTimeout)
+	defer cancel()
+	for {
+		select {
+		case <-o.done:
+			return
+		case data := <-o.queue:
+			if err := writeFrame(ctx, o.conn, data); err != nil {
+				o.abort(err)
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// keepAlive pings the client every PingInterval. coder/websocket lets a
+// ping go out between the writer's frames, and the pong is read by the
+// handler's read loop.
+func (o *Outbox) keepAlive() {
+	ticker := time.NewTicker(o.opts.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), o.opts.WriteTimeout)
+			err := o.conn.Ping(ctx)
+			cancel()
+			if err != nil {
+				o.abort(err)
+				return
+			}
+		}
+	}
+}
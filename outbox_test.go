@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// socketPair returns the server end of a WebSocket and the client end,
+// which nothing reads until the test does.
+func socketPair(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		accepted <- conn
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { client.CloseNow() })
+	server := <-accepted
+	t.Cleanup(func() { server.CloseNow() })
+	return server, client
+}
+
+// flood sends frames big enough to fill the socket buffers of a client
+// that isn't reading, and returns the first error from Send.
+func flood(out *Outbox, frames int) error {
+	frame := []byte(`{"type":"message","content":"` + strings.Repeat("a", 256<<10) + `"}`)
+	for range frames {
+		if err := out.Send(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestOutboxDropsOldest(t *testing.T) {
+	server, client := socketPair(t)
+	out := newOutbox(server, OutboxOptions{QueueSize: 2, Overflow: OverflowDropOldest})
+	defer out.stop()
+
+	start := time.Now()
+	if err := flood(out, 100); err != nil {
+		t.Fatalf("expected sends to succeed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Send not to wait on the client, took %s", elapsed)
+	}
+	if out.Dropped() == 0 {
+		t.Error("expected frames to be dropped for a client that isn't reading")
+	}
+
+	// Whatever the client does read arrives intact.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client.SetReadLimit(-1)
+	if _, data, err := client.Read(ctx); err != nil || !strings.HasPrefix(string(data), `{"type":"message"`) {
+		t.Errorf("expected a whole frame, got %.40q (%v)", data, err)
+	}
+}
+
+func TestOutboxDisconnectsSlowConsumer(t *testing.T) {
+	server, _ := socketPair(t)
+	out := newOutbox(server, OutboxOptions{QueueSize: 2, Overflow: OverflowDisconnect})
+
+	if err := flood(out, 100); err != errSlowConsumer {
+		t.Fatalf("expected errSlowConsumer, got %v", err)
+	}
+	if err := out.Send([]byte(`{}`)); err != errOutboxClosed {
+		t.Errorf("expected a closed outbox to refuse frames, got %v", err)
+	}
+}
+
+func TestOutboxDropsUnresponsiveSocket(t *testing.T) {
+	server, _ := socketPair(t)
+	// The client never reads, so it never answers a ping.
+	out := newOutbox(server, OutboxOptions{PingInterval: 20 * time.Millisecond, WriteTimeout: 50 * time.Millisecond})
+
+	select {
+	case <-out.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a socket that misses its pong to be dropped")
+	}
+}
+
+func TestClosedRoomErrorReachesClient(t *testing.T) {
+	hub := newTestHub(t)
+	var started StartChatResponse
+	json.NewDecoder(startChat(t, hub, `{"name":"Alice","content":"Olá"}`, "").Body).Decode(&started)
+	room, _ := hub.GetRoom(started.RoomID)
+	customer := room.Customer
+	conn, read := dialSocket(t, hub, "/ws?room_id="+room.ID, started.Token)
+	waitFor(t, "customer online", func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return customer.Online
+	})
+	if _, _, err := hub.EndChat(room, customer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The handler returns as soon as it has queued both frames; they
+	// must still be written before the socket closes.
+	conn.Write(context.Background(), websocket.MessageText, []byte(`{"type":"message","content":"Olá?","ref":"m1"}`))
+	if frame := read(); frame["type"] != "sent" || frame["ref"] != "m1" {
+		t.Fatalf("expected the sent ack, got %v", frame)
+	}
+	if frame := read(); frame["type"] != "error" || frame["code"] != string(CodeRoomClosed) {
+		t.Fatalf("expected a room_closed error, got %v", frame)
+	}
+}
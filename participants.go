@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+)
+
+var (
+	errRoomClosed    = errors.New("room is closed")
+	errAlreadyInRoom = errors.New("already in this room")
+)
+
+// participantRecord is a participant as replicated between instances.
+type participantRecord struct {
+	Token string          `json:"token"`
+	Mode  ParticipantMode `json:"mode"`
+}
+
+// Watch adds supervisor to room in mode, or switches their mode if
+// they're already there. It reports whether they just joined.
+func (h *Hub) Watch(room *Room, supervisor *Client, mode ParticipantMode) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if room.Status == RoomClosed {
+		return false, errRoomClosed
+	}
+	joined := true
+	if p := findParticipant(room, supervisor); p != nil {
+		p.Mode = mode
+		joined = false
+	} else {
+		room.Participants = append(room.Participants, &Participant{Client: supervisor, Mode: mode})
+	}
+	h.emitParticipants(room)
+	slog.Info("supervisor watching room", "room", room.ID, "supervisor", supervisor.Name, "mode", mode)
+	return joined, nil
+}
+
+// Invite adds invitee to room as a full member of the conversation. Only
+// the room's agent can invite, and only staff who are online.
+func (h *Hub) Invite(room *Room, inviter *Client, invitee *Client, note string) error {
+	h.mu.Lock()
+	if room.Agent == nil || room.Agent.Token != inviter.Token || room.Status != RoomActive {
+		h.mu.Unlock()
+		return errNotRoomAgent
+	}
+	if invitee.Token == inviter.Token || findParticipant(room, invitee) != nil {
+		h.mu.Unlock()
+		return errAlreadyInRoom
+	}
+	if invitee.Role == RoleCustomer || !invitee.Online {
+		h.mu.Unlock()
+		return errAgentUnavailable
+	}
+	room.Participants = append(room.Participants, &Participant{Client: invitee, Mode: ModeMember})
+	h.emitParticipants(room)
+	topic := room.Topic
+	language := room.Customer.Language
+	h.mu.Unlock()
+	slog.Info("participant invited", "room", room.ID, "by", inviter.Name, "invitee", invitee.Name)
+
+	event, _ := json.Marshal(AssignedEvent{
+		Type:         "invited",
+		RoomID:       room.ID,
+		CustomerName: room.Customer.Name,
+		CustomerID:   room.Customer.ID(),
+		Language:     language,
+		Topic:        topic,
+		InvitedBy:    inviter.Name,
+		Note:         note,
+	})
+	if err := h.Deliver(context.Background(), invitee, event); err != nil {
+		slog.Error("failed to notify invitee", "invitee", invitee.Name, "error", err)
+	}
+	return nil
+}
+
+// RemoveParticipant takes client out of room's participants.
+func (h *Hub) RemoveParticipant(room *Room, client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeParticipant(room, client)
+}
+
+// RemoveFromAllRooms removes client from every room they're a participant
+// in, e.g. when a supervisor's socket closes.
+func (h *Hub) RemoveFromAllRooms(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, room := range h.Rooms {
+		h.removeParticipant(room, client)
+	}
+}
+
+// IsMember reports whether client may send to and read room as staff: its
+// agent or one of its participants.
+func (h *Hub) IsMember(room *Room, client *Client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if room.Agent != nil && room.Agent.Token == client.Token {
+		return true
+	}
+	return findParticipant(room, client) != nil
+}
+
+// removeParticipant drops client from room's participants.
+// Callers must hold h.mu.
+func (h *Hub) removeParticipant(room *Room, client *Client) {
+	for i, p := range room.Participants {
+		if p.Client.Token == client.Token {
+			room.Participants = append(room.Participants[:i:i], room.Participants[i+1:]...)
+			h.emitParticipants(room)
+			return
+		}
+	}
+}
+
+// emitParticipants replicates room's participant list. Callers must hold
+// h.mu.
+func (h *Hub) emitParticipants(room *Room) {
+	records := make([]participantRecord, 0, len(room.Participants))
+	for _, p := range room.Participants {
+		records = append(records, participantRecord{Token: p.Client.Token, Mode: p.Mode})
+	}
+	h.emit(hubEvent{Kind: eventParticipants, RoomID: room.ID, Participants: records})
+}
+
+func findParticipant(room *Room, client *Client) *Participant {
+	for _, p := range room.Participants {
+		if p.Client.Token == client.Token {
+			return p
+		}
+	}
+	return nil
+}
+
+// ParticipantMode returns how client takes part in room, if they're a
+// participant rather than its customer or agent.
+func (h *Hub) ParticipantMode(room *Room, client *Client) (ParticipantMode, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if p := findParticipant(room, client); p != nil {
+		return p.Mode, true
+	}
+	return "", false
+}
+
+// Audience returns everyone in room who should receive a message from
+// sender. Whispers never reach the customer.
+func (h *Hub) Audience(room *Room, sender *Client, whisper bool) []*Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.audience(room, sender, whisper)
+}
+
+// Recipients returns the members of Audience who are online, as a
+// pipeline job about to deliver to them should see them.
+func (h *Hub) Recipients(room *Room, sender *Client, whisper bool) []party {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var recipients []party
+	for _, client := range h.audience(room, sender, whisper) {
+		if client.Online {
+			recipients = append(recipients, h.party(client))
+		}
+	}
+	return recipients
+}
+
+// Party copies what a pipeline job needs to know about client.
+func (h *Hub) Party(client *Client) party {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.party(client)
+}
+
+// party is Party for callers that hold h.mu.
+func (h *Hub) party(client *Client) party {
+	return party{
+		client:    client,
+		name:      client.Name,
+		language:  client.Language,
+		source:    client.LanguageSource,
+		languages: client.Languages,
+		streaming: client.Streaming,
+	}
+}
+
+// audience is Audience for callers that hold h.mu.
+func (h *Hub) audience(room *Room, sender *Client, whisper bool) []*Client {
+	var audience []*Client
+	add := func(client *Client) {
+		if client == nil || client.Token == sender.Token {
+			return
+		}
+		audience = append(audience, client)
+	}
+	if !whisper {
+		add(room.Customer)
+	}
+	add(room.Agent)
+	for _, p := range room.Participants {
+		add(p.Client)
+	}
+	return audience
+}
+
+// ActiveRooms returns rooms with an agent, oldest first, for supervisors
+// to pick from.
+func (h *Hub) ActiveRooms() []*Room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var rooms []*Room
+	for _, room := range h.Rooms {
+		if room.Status == RoomActive {
+			rooms = append(rooms, room)
+		}
+	}
+	sortByCreated(rooms)
+	return rooms
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coder/websocket"
+)
+
+func TestAudienceWhisperSkipsCustomer(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	lead := NewClient("Lea", "en")
+	lead.Role = RoleSupervisor
+	hub.Watch(room, lead, ModeWhisper)
+
+	whisper := hub.Audience(room, lead, true)
+	if len(whisper) != 1 || whisper[0] != bob {
+		t.Errorf("expected whisper to reach only Bob, got %v", whisper)
+	}
+	fromCustomer := hub.Audience(room, room.Customer, false)
+	if len(fromCustomer) != 2 || fromCustomer[0] != bob || fromCustomer[1] != lead {
+		t.Errorf("expected customer message to reach Bob and Lea, got %v", fromCustomer)
+	}
+}
+
+func TestWatchSwitchesMode(t *testing.T) {
+	hub := newTestHub(t)
+	room := assignedTo(t, hub, NewClient("Bob", "en"))
+	lead := NewClient("Lea", "en")
+
+	if joined, _ := hub.Watch(room, lead, ModeMonitor); !joined {
+		t.Fatal("expected first watch to join")
+	}
+	if joined, _ := hub.Watch(room, lead, ModeBarge); joined {
+		t.Fatal("expected second watch to switch mode, not join again")
+	}
+	if mode, _ := hub.ParticipantMode(room, lead); mode != ModeBarge || len(room.Participants) != 1 {
+		t.Errorf("expected a single barge participant, got %s / %d", mode, len(room.Participants))
+	}
+
+	hub.RemoveFromAllRooms(lead)
+	if _, ok := hub.ParticipantMode(room, lead); ok {
+		t.Error("expected supervisor to be gone after RemoveFromAllRooms")
+	}
+}
+
+func TestSupervisorWhisperAndBargeIn(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	hub.AddClient(bob)
+	_, agentRead := dialAgent(t, hub, bob)
+	alice := NewClient("Alice", "pt")
+	alice.Role = RoleCustomer
+	hub.AddClient(alice)
+	room := hub.CreateRoom(alice, "")
+	if frame := agentRead(); frame["type"] != "assigned" {
+		t.Fatalf("expected assigned event, got %v", frame)
+	}
+	_, customerRead := dialSocket(t, hub, "/ws?room_id="+room.ID, signedToken(t, alice))
+	waitFor(t, "customer online", func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return alice.Online
+	})
+	if frame := agentRead(); frame["type"] != "participant_connected" || frame["name"] != "Alice" {
+		t.Fatalf("expected Alice's presence event, got %v", frame)
+	}
+
+	lead := NewClient("Lea", "en")
+	lead.Role = RoleSupervisor
+	hub.AddClient(lead)
+	conn, leadRead := dialSocket(t, hub, "/supervisor-ws", signedToken(t, lead))
+	ctx := context.Background()
+	send := func(frame string) { conn.Write(ctx, websocket.MessageText, []byte(frame)) }
+
+	send(`{"type":"watch","room_id":"` + room.ID + `"}`)
+	if frame := leadRead(); frame["type"] != "watching" || frame["mode"] != "monitor" {
+		t.Fatalf("expected monitor ack, got %v", frame)
+	}
+	send(`{"room_id":"` + room.ID + `","content":"hi"}`)
+	if frame := leadRead(); frame["type"] != "error" {
+		t.Fatalf("expected monitors to be read-only, got %v", frame)
+	}
+
+	send(`{"type":"watch","room_id":"` + room.ID + `","mode":"whisper"}`)
+	leadRead()
+	send(`{"room_id":"` + room.ID + `","content":"offer a refund"}`)
+	if frame := agentRead(); frame["type"] != "whisper" || frame["content"] != "offer a refund" {
+		t.Fatalf("expected whisper for Bob, got %v", frame)
+	}
+
+	send(`{"type":"watch","room_id":"` + room.ID + `","mode":"barge"}`)
+	leadRead()
+	send(`{"room_id":"` + room.ID + `","content":"Hello"}`)
+	// The whisper was never sent to Alice, so the barge-in is the first
+	// thing she hears from staff.
+	if frame := customerRead(); frame["type"] != "message" || frame["from"] != "Lea" || frame["content"] != "[pt] Hello" {
+		t.Errorf("expected translated barge-in for Alice, got %v", frame)
+	}
+	if frame := agentRead(); frame["type"] != "message" || frame["from"] != "Lea" {
+		t.Errorf("expected Bob to see the barge-in, got %v", frame)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// retranslateMessages is how much of a room's history a language change
+// re-sends.
+const retranslateMessages = 20
+
+// defaultMaxQueued is how many jobs a room can have waiting before Submit
+// refuses more.
+const defaultMaxQueued = 256
+
+var errPipelineFull = errors.New("too many messages waiting to be translated")
+
+// Pipeline runs translation and delivery off the sockets' read loops, so a
+// sender can keep typing while the backend thinks. Jobs for one room run
+// one at a time in the order they were submitted, which keeps everyone's
+// view of the room in order; different rooms run concurrently, and the
+// translator's backend slots bound how much of that reaches the backend.
+type Pipeline struct {
+	hub        *Hub
+	translator *Translator
+	maxQueued  int
+
+	mu sync.Mutex
+	// rooms holds the pending jobs of every room with a worker draining
+	// it; a room has a worker exactly when it has an entry.
+	rooms map[string]*roomQueue
+
+	queued    atomic.Int64
+	workers   atomic.Int64
+	processed atomic.Int64
+	rejected  atomic.Int64
+}
+
+// roomQueue is a room's pending jobs. History replays wait in a line of
+// their own, which the worker serves first.
+type roomQueue struct {
+	replays []func(ctx context.Context)
+	jobs    []func(ctx context.Context)
+}
+
+// PipelineStats reports the pipeline's queue depth across rooms, how many
+// room workers are running, how many jobs were refused because their room
+// was full, and how busy the backend is.
+type PipelineStats struct {
+	Queued    int64        `json:"queued"`
+	Workers   int64        `json:"workers"`
+	Processed int64        `json:"processed"`
+	Rejected  int64        `json:"rejected"`
+	Backend   BackendStats `json:"backend"`
+}
+
+func NewPipeline(hub *Hub, translator *Translator) *Pipeline {
+	return &Pipeline{
+		hub:        hub,
+		translator: translator,
+		maxQueued:  defaultMaxQueued,
+		rooms:      make(map[string]*roomQueue),
+	}
+}
+
+// SetMaxQueued caps how many jobs each room can have waiting; Submit
+// refuses the rest. Call it before the pipeline is used.
+func (p *Pipeline) SetMaxQueued(n int) {
+	if n > 0 {
+		p.maxQueued = n
+	}
+}
+
+// Submit queues job behind room's pending jobs, starting a worker for the
+// room if it has none. If the room already has its fill of jobs waiting,
+// job is dropped and Submit returns errPipelineFull.
+func (p *Pipeline) Submit(room *Room, job func(ctx context.Context)) error {
+	return p.enqueue(room, job, false)
+}
+
+func (p *Pipeline) enqueue(room *Room, job func(ctx context.Context), replay bool) error {
+	p.mu.Lock()
+	queue, running := p.rooms[room.ID]
+	if running && len(queue.replays)+len(queue.jobs) >= p.maxQueued {
+		p.mu.Unlock()
+		p.rejected.Add(1)
+		slog.Warn("room pipeline full, dropping job", "room", room.ID, "queued", p.maxQueued)
+		return errPipelineFull
+	}
+	if !running {
+		queue = &roomQueue{}
+		p.rooms[room.ID] = queue
+	}
+	if replay {
+		queue.replays = append(queue.replays, job)
+	} else {
+		queue.jobs = append(queue.jobs, job)
+	}
+	p.mu.Unlock()
+	p.queued.Add(1)
+
+	if !running {
+		p.workers.Add(1)
+		go p.drain(room.ID)
+	}
+	return nil
+}
+
+// drain runs a room's jobs, replays first, until its queue is empty.
+func (p *Pipeline) drain(roomID string) {
+	defer p.workers.Add(-1)
+	for {
+		p.mu.Lock()
+		queue := p.rooms[roomID]
+		var job func(ctx context.Context)
+		switch {
+		case len(queue.replays) > 0:
+			job, queue.replays = queue.replays[0], queue.replays[1:]
+		case len(queue.jobs) > 0:
+			job, queue.jobs = queue.jobs[0], queue.jobs[1:]
+		default:
+			delete(p.rooms, roomID)
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+
+		p.queued.Add(-1)
+		job(context.Background())
+		p.processed.Add(1)
+	}
+}
+
+// History queues a replay of room's transcript for client (see
+// sendHistory). The transcript and client's language are read now, and
+// the replay runs ahead of
+// any message still waiting to be translated: those go to whoever was
+// online when they were sent, so a client who has just connected gets
+// them once, in the replay, before anything sent after it.
+func (p *Pipeline) History(room *Room, client *Client, after string) {
+	history := p.hub.History(room)
+	recipient := p.hub.Party(client)
+	err := p.enqueue(room, func(ctx context.Context) {
+		sendHistory(ctx, p.hub, p.translator, room, recipient, history, after)
+	}, true)
+	if err != nil {
+		sendError(context.Background(), p.hub, client, ErrorResponse{Code: CodeRateLimited, RoomID: room.ID,
+			Message: "room is busy; ask for its history again shortly"})
+	}
+}
+
+// Retranslate queues a re-send of room's last retranslateMessages messages
+// to client in the language they have now (see sendRecent), after a
+// language change.
+func (p *Pipeline) Retranslate(room *Room, client *Client) {
+	recipient := p.hub.Party(client)
+	err := p.Submit(room, func(ctx context.Context) {
+		sendRecent(ctx, p.hub, p.translator, room, recipient, retranslateMessages)
+	})
+	if err != nil {
+		sendError(context.Background(), p.hub, client, ErrorResponse{Code: CodeRateLimited, RoomID: room.ID,
+			Message: "room is busy; recent messages weren't re-sent in your new language"})
+	}
+}
+
+func (p *Pipeline) Stats() PipelineStats {
+	return PipelineStats{
+		Queued:    p.queued.Load(),
+		Workers:   p.workers.Load(),
+		Processed: p.processed.Load(),
+		Rejected:  p.rejected.Load(),
+		Backend:   p.translator.BackendStats(),
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPipelineKeepsRoomOrder(t *testing.T) {
+	hub := newTestHub(t)
+	pipeline := NewPipeline(hub, NewTranslator(NewFakeProvider(), NewTranslationCache(CacheOptions{TTL: time.Minute})))
+	first := hub.CreateRoom(NewClient("Alice", "pt"), "")
+	second := hub.CreateRoom(NewClient("Carla", "es"), "")
+
+	var mu sync.Mutex
+	var order []int
+	release := make(chan struct{})
+	pipeline.Submit(first, func(ctx context.Context) { <-release })
+	for i := range 5 {
+		pipeline.Submit(first, func(ctx context.Context) {
+			// Later jobs finish faster, so only the queue keeps them in order.
+			time.Sleep(time.Duration(5-i) * time.Millisecond)
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+		})
+	}
+
+	// A blocked room doesn't hold up another.
+	done := make(chan struct{})
+	pipeline.Submit(second, func(ctx context.Context) { close(done) })
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the second room's job to run while the first is blocked")
+	}
+	waitFor(t, "5 jobs queued behind the blocked one", func() bool {
+		stats := pipeline.Stats()
+		return stats.Queued == 5 && stats.Workers == 1
+	})
+
+	close(release)
+	waitFor(t, "the first room to drain", func() bool { return pipeline.Stats().Processed == 7 })
+	mu.Lock()
+	defer mu.Unlock()
+	for i, n := range order {
+		if n != i {
+			t.Fatalf("expected jobs in submission order, got %v", order)
+		}
+	}
+	if stats := pipeline.Stats(); stats.Queued != 0 || stats.Workers != 0 {
+		t.Errorf("expected an idle pipeline, got %+v", stats)
+	}
+}
+
+func TestTranslatorBoundsBackendCalls(t *testing.T) {
+	provider := NewFakeProvider()
+	provider.Delay = 100 * time.Millisecond
+	translator := NewTranslator(provider, NewTranslationCache(CacheOptions{TTL: time.Minute}))
+	translator.SetMaxConcurrent(2)
+
+	var wg sync.WaitGroup
+	for _, language := range []string{"pt", "es", "fr", "de", "it", "nl"} {
+		wg.Go(func() { translator.Translate(context.Background(), "hello", "en", language) })
+	}
+	waitFor(t, "every call to reach the backend", func() bool {
+		stats := translator.BackendStats()
+		return stats.InFlight+stats.Waiting == 6
+	})
+	if stats := translator.BackendStats(); stats.InFlight != 2 || stats.Waiting != 4 || stats.Utilisation != 1 {
+		t.Errorf("expected 2 calls in flight and 4 waiting, got %+v", stats)
+	}
+	wg.Wait()
+	if stats := translator.BackendStats(); stats.InFlight != 0 || stats.Waiting != 0 {
+		t.Errorf("expected an idle backend, got %+v", stats)
+	}
+}
+
+func TestSlowTranslationDoesNotBlockSender(t *testing.T) {
+	hub := newTestHub(t)
+	provider := NewFakeProvider()
+	provider.Delay = 100 * time.Millisecond
+	pipeline := NewPipeline(hub, NewTranslator(provider, NewTranslationCache(CacheOptions{TTL: time.Minute})))
+	limiter := NewRateLimiter(100, time.Minute)
+
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	alice := room.Customer
+	hub.mu.Lock()
+	alice.Online = true
+	hub.mu.Unlock()
+	acks := captureFrames(t, hub, bob)
+	frames := captureFrames(t, hub, alice)
+
+	start := time.Now()
+	for _, content := range []string{"one", "two", "three"} {
+		relayMessage(context.Background(), hub, pipeline, limiter, room, bob, content, content)
+	}
+	var seq int64
+	for range 3 {
+		ack := receive(t, acks)
+		if ack.Type != "sent" || ack.Seq <= seq {
+			t.Fatalf("expected sent acks in order, got %+v after seq %d", ack, seq)
+		}
+		seq = ack.Seq
+	}
+	if elapsed := time.Since(start); elapsed >= provider.Delay {
+		t.Errorf("expected the sender's acks before any translation finished, took %s", elapsed)
+	}
+
+	for _, want := range []string{"[pt] one", "[pt] two", "[pt] three"} {
+		if msg := receive(t, frames); msg.Content != want {
+			t.Fatalf("expected %q, got %q", want, msg.Content)
+		}
+	}
+}
+
+func TestPipelineSnapshotsLanguages(t *testing.T) {
+	hub := newTestHub(t)
+	pipeline := NewPipeline(hub, NewTranslator(NewFakeProvider(), NewTranslationCache(CacheOptions{TTL: time.Minute})))
+	limiter := NewRateLimiter(100, time.Minute)
+
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	alice := room.Customer
+	hub.mu.Lock()
+	alice.Online = true
+	hub.mu.Unlock()
+	frames := captureFrames(t, hub, alice)
+
+	// Alice switches language while Bob's messages wait to be translated;
+	// each is translated into the language she had when it was sent.
+	want := make([]string, 0, 6)
+	for i, language := range []string{"pt", "es", "fr", "pt", "es", "fr"} {
+		hub.DeclareLanguage(alice, language)
+		content := fmt.Sprint("message ", i)
+		relayMessage(context.Background(), hub, pipeline, limiter, room, bob, content, "")
+		want = append(want, "["+language+"] "+content)
+	}
+	for _, content := range want {
+		if msg := receive(t, frames); msg.Content != content {
+			t.Fatalf("expected %q, got %q", content, msg.Content)
+		}
+	}
+}
+
+func TestHistoryRunsAheadOfWaitingMessages(t *testing.T) {
+	hub := newTestHub(t)
+	pipeline := NewPipeline(hub, NewTranslator(NewFakeProvider(), NewTranslationCache(CacheOptions{TTL: time.Minute})))
+	limiter := NewRateLimiter(100, time.Minute)
+	ctx := context.Background()
+
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	alice := room.Customer
+	release := make(chan struct{})
+	pipeline.Submit(room, func(ctx context.Context) { <-release })
+	relayMessage(ctx, hub, pipeline, limiter, room, alice, "Olá", "")
+
+	// Bob connects while Alice's message is still waiting, and she writes
+	// again straight after.
+	hub.mu.Lock()
+	bob.Online = true
+	hub.mu.Unlock()
+	frames := captureFrames(t, hub, bob)
+	pipeline.History(room, bob, "")
+	relayMessage(ctx, hub, pipeline, limiter, room, alice, "Tudo bem?", "")
+	close(release)
+
+	for _, want := range []string{"[en] Olá", "[en] Tudo bem?"} {
+		if msg := receive(t, frames); msg.TranslatedContent != want {
+			t.Fatalf("expected %q, got %+v", want, msg)
+		}
+	}
+	waitFor(t, "the room to drain", func() bool { return pipeline.Stats().Processed == 4 })
+	select {
+	case msg := <-frames:
+		t.Errorf("expected each message once, got %+v again", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPipelineRefusesJobsWhenRoomIsFull(t *testing.T) {
+	hub := newTestHub(t)
+	pipeline := NewPipeline(hub, NewTranslator(NewFakeProvider(), NewTranslationCache(CacheOptions{TTL: time.Minute})))
+	pipeline.SetMaxQueued(2)
+	busy := hub.CreateRoom(NewClient("Alice", "pt"), "")
+	quiet := hub.CreateRoom(NewClient("Carla", "es"), "")
+
+	release := make(chan struct{})
+	defer close(release)
+	pipeline.Submit(busy, func(ctx context.Context) { <-release })
+	waitFor(t, "the blocking job to start", func() bool { return pipeline.Stats().Queued == 0 })
+
+	for range 2 {
+		if err := pipeline.Submit(busy, func(ctx context.Context) {}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := pipeline.Submit(busy, func(ctx context.Context) {}); !errors.Is(err, errPipelineFull) {
+		t.Errorf("expected a full room to refuse the job, got %v", err)
+	}
+	if err := pipeline.Submit(quiet, func(ctx context.Context) {}); err != nil {
+		t.Errorf("expected another room to take jobs, got %v", err)
+	}
+	if stats := pipeline.Stats(); stats.Rejected != 1 {
+		t.Errorf("expected 1 rejected job, got %+v", stats)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// typingInterval is the least time between two relayed typing_start
+// events from one client in one room. Clients keep resending typing_start
+// while the user types; receivers should drop an indicator that hasn't
+// been refreshed for a couple of intervals.
+const typingInterval = 3 * time.Second
+
+func typingKey(client *Client, room *Room) string {
+	return client.Token + " " + room.ID
+}
+
+// relayTyping forwards a typing_start or typing_stop from client to the
+// rest of room. Typing events skip translation and the message rate
+// limiter; allowTyping drops the repeats instead. Whispering supervisors
+// only show as typing to staff, and monitors not at all.
+func relayTyping(ctx context.Context, hub *Hub, room *Room, client *Client, kind string) {
+	whisper := false
+	if mode, ok := hub.ParticipantMode(room, client); ok {
+		if mode == ModeMonitor {
+			return
+		}
+		whisper = mode == ModeWhisper
+	}
+	if !hub.allowTyping(client, room, kind == "typing_start") {
+		return
+	}
+
+	data, _ := json.Marshal(TypingEvent{
+		Type:     kind,
+		RoomID:   room.ID,
+		From:     hub.Party(client).name,
+		SenderID: client.ID(),
+	})
+	for _, recipient := range hub.Recipients(room, client, whisper) {
+		if err := hub.Deliver(ctx, recipient.client, data); err != nil {
+			slog.Error("failed to send typing event", "recipient", recipient.name, "error", err)
+		}
+	}
+}
+
+// allowTyping is the typing throttle. A start goes out when the client
+// wasn't typing, or as a keep-alive once typingInterval has passed; a
+// stop only goes out to end a start.
+func (h *Hub) allowTyping(client *Client, room *Room, start bool) bool {
+	key := typingKey(client, room)
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	last, typing := h.typing[key]
+	if !start {
+		delete(h.typing, key)
+		return typing
+	}
+	if typing && now.Sub(last) < typingInterval {
+		return false
+	}
+	h.typing[key] = now
+	return true
+}
+
+// notifyPresence tells the other members of client's open rooms that its
+// socket came up or went away. Supervisors who are monitoring or
+// whispering stay invisible to the customer.
+func (h *Hub) notifyPresence(client *Client, connected bool) {
+	kind := "participant_disconnected"
+	if connected {
+		kind = "participant_connected"
+	}
+
+	type notice struct {
+		room       *Room
+		recipients []party
+	}
+	var notices []notice
+	h.mu.Lock()
+	name, role := client.Name, client.Role
+	if !connected {
+		// Nobody is left to send the typing_stop.
+		for key := range h.typing {
+			if strings.HasPrefix(key, client.Token+" ") {
+				delete(h.typing, key)
+			}
+		}
+	}
+	for _, room := range h.Rooms {
+		if room.Status == RoomClosed {
+			continue
+		}
+		hidden := false
+		if room.Customer != client && room.Agent != client {
+			p := findParticipant(room, client)
+			if p == nil {
+				continue
+			}
+			hidden = p.Mode == ModeMonitor || p.Mode == ModeWhisper
+		}
+		var recipients []party
+		for _, recipient := range h.audience(room, client, hidden) {
+			if recipient.Online {
+				recipients = append(recipients, h.party(recipient))
+			}
+		}
+		notices = append(notices, notice{room, recipients})
+	}
+	h.mu.Unlock()
+
+	ctx := context.Background()
+	for _, n := range notices {
+		data, _ := json.Marshal(PresenceEvent{
+			Type:     kind,
+			RoomID:   n.room.ID,
+			ClientID: client.ID(),
+			Name:     name,
+			Role:     role,
+		})
+		for _, recipient := range n.recipients {
+			if err := h.Deliver(ctx, recipient.client, data); err != nil {
+				slog.Error("failed to send presence event", "recipient", recipient.name, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coder/websocket"
+)
+
+func TestTypingThrottle(t *testing.T) {
+	hub := newTestHub(t)
+	client := NewClient("Alice", "pt")
+	room := hub.CreateRoom(client, "")
+
+	steps := []struct {
+		start bool
+		want  bool
+	}{
+		{start: true, want: true},
+		{start: true, want: false}, // repeat within typingInterval
+		{start: false, want: true},
+		{start: false, want: false}, // nothing to stop
+		{start: true, want: true},
+	}
+	for i, step := range steps {
+		if got := hub.allowTyping(client, room, step.start); got != step.want {
+			t.Errorf("step %d (start=%v): expected %v, got %v", i, step.start, step.want, got)
+		}
+	}
+}
+
+func TestTypingAndPresenceEvents(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	hub.AddClient(bob)
+	_, agentRead := dialAgent(t, hub, bob)
+	alice := NewClient("Alice", "pt")
+	alice.Role = RoleCustomer
+	hub.AddClient(alice)
+	room := hub.CreateRoom(alice, "")
+	if frame := agentRead(); frame["type"] != "assigned" {
+		t.Fatalf("expected assigned event, got %v", frame)
+	}
+
+	conn, _ := dialSocket(t, hub, "/ws?room_id="+room.ID, signedToken(t, alice))
+	if frame := agentRead(); frame["type"] != "participant_connected" || frame["client_id"] != alice.ID() || frame["role"] != "customer" {
+		t.Fatalf("expected Alice's participant_connected, got %v", frame)
+	}
+
+	ctx := context.Background()
+	for _, kind := range []string{"typing_start", "typing_start", "typing_stop"} {
+		conn.Write(ctx, websocket.MessageText, []byte(`{"type":"`+kind+`"}`))
+	}
+	// The repeated start is throttled away.
+	for _, want := range []string{"typing_start", "typing_stop"} {
+		if frame := agentRead(); frame["type"] != want || frame["from"] != "Alice" || frame["room_id"] != room.ID {
+			t.Errorf("expected %s from Alice, got %v", want, frame)
+		}
+	}
+
+	conn.Close(websocket.StatusNormalClosure, "")
+	if frame := agentRead(); frame["type"] != "participant_disconnected" || frame["client_id"] != alice.ID() {
+		t.Errorf("expected Alice's participant_disconnected, got %v", frame)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/coder/websocket"
+)
+
+const (
+	// protocolV1 is the versioned subprotocol: every frame is an Envelope.
+	// Servers prefer it over the legacy socketProtocol when a client
+	// offers both.
+	protocolV1      = "chat.v1"
+	protocolVersion = 1
+	// maxContentLength caps a message's content, in characters.
+	maxContentLength = 4000
+)
+
+// clientFrameFields lists every client frame type and the payload fields
+// it requires. decodeFrame enforces it and the schema publishes it.
+var clientFrameFields = map[string][]string{
+	"message":      {"content"},
+	"typing_start": nil,
+	"typing_stop":  nil,
+	"delivered":    {"id"},
+	"read":         {"id"},
+	"history":      nil,
+	"watch":        nil,
+	"leave":        nil,
+	"set_language": {"language"},
+}
+
+// frameError is a client frame the server couldn't accept.
+type frameError struct {
+	code    ErrorCode
+	message string
+}
+
+func (e *frameError) Error() string { return e.message }
+
+func invalidPayload(format string, args ...any) *frameError {
+	return &frameError{code: CodeInvalidPayload, message: fmt.Sprintf(format, args...)}
+}
+
+// decodeFrame parses a frame a client sent on a socket that negotiated
+// protocol. A chat.v1 frame must be an Envelope of the current version
+// whose payload has no unknown fields; a legacy frame is a bare
+// ClientFrame, and one without a type is a message. Either way the frame
+// is checked against clientFrameFields. On error the returned frame has
+// whatever Ref and RoomID could be read, for the error to echo.
+func decodeFrame(protocol string, data []byte) (ClientFrame, error) {
+	var frame ClientFrame
+	if protocol != protocolV1 {
+		if err := json.Unmarshal(data, &frame); err != nil {
+			return frame, invalidPayload("invalid json: %v", err)
+		}
+		if frame.Type == "" {
+			frame.Type = "message"
+		}
+		return frame, frame.validate()
+	}
+
+	var env Envelope
+	if err := decodeStrict(data, &env); err != nil {
+		return frame, invalidPayload("invalid envelope: %v", err)
+	}
+	frame.Ref = env.ID
+	if env.V != protocolVersion {
+		return frame, &frameError{code: CodeUnsupportedVersion, message: fmt.Sprintf("unsupported protocol version %d, want %d", env.V, protocolVersion)}
+	}
+	if len(env.Payload) > 0 {
+		if err := decodeStrict(env.Payload, &frame); err != nil {
+			return frame, invalidPayload("invalid %s payload: %v", env.Type, err)
+		}
+	}
+	frame.Type = env.Type
+	frame.Ref = env.ID
+	return frame, frame.validate()
+}
+
+// decodeStrict unmarshals data into v, rejecting fields v doesn't have.
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func (f ClientFrame) validate() error {
+	required, ok := clientFrameFields[f.Type]
+	if !ok {
+		return invalidPayload("unknown frame type: %q", f.Type)
+	}
+	for _, field := range required {
+		value := map[string]string{"content": f.Content, "id": f.ID, "language": f.Language}[field]
+		if strings.TrimSpace(value) == "" {
+			return invalidPayload("%s requires %s", f.Type, field)
+		}
+	}
+	if utf8.RuneCountInString(f.Content) > maxContentLength {
+		return invalidPayload("content is longer than %d characters", maxContentLength)
+	}
+	if _, ok := canonicalLanguage(f.Language); f.Language != "" && !ok {
+		return invalidPayload("language must be a BCP 47 tag with an ISO 639 language, like pt or pt-BR")
+	}
+	if f.Mode != "" && !validMode(f.Mode) {
+		return invalidPayload("mode must be monitor, whisper or barge")
+	}
+	return nil
+}
+
+// rejectFrame answers a frame decodeFrame refused.
+func rejectFrame(ctx context.Context, hub *Hub, client *Client, frame ClientFrame, err error) {
+	slog.Warn("invalid frame", "client", client.Name, "error", err)
+	e := ErrorResponse{Code: CodeInvalidPayload, RoomID: frame.RoomID, Ref: frame.Ref, Message: err.Error()}
+	if fe, ok := err.(*frameError); ok {
+		e.Code = fe.code
+	}
+	sendError(ctx, hub, client, e)
+}
+
+// writeFrame writes a server frame to conn, wrapped in an Envelope if the
+// socket negotiated chat.v1.
+func writeFrame(ctx context.Context, conn *websocket.Conn, data []byte) error {
+	if conn.Subprotocol() == protocolV1 {
+		data = wrapFrame(data)
+	}
+	return conn.Write(ctx, websocket.MessageText, data)
+}
+
+// wrapFrame puts a server frame in an Envelope. The envelope's type is
+// the frame's, and its ID is the frame's ref, so a client can match
+// answers to what it sent without looking inside the payload.
+func wrapFrame(data []byte) []byte {
+	var head struct {
+		Type string `json:"type"`
+		Ref  string `json:"ref"`
+	}
+	json.Unmarshal(data, &head)
+	wrapped, err := json.Marshal(Envelope{V: protocolVersion, Type: head.Type, ID: head.Ref, Payload: data})
+	if err != nil {
+		return data
+	}
+	return wrapped
+}
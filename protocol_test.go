@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+func TestSchemaUpToDate(t *testing.T) {
+	want, err := json.MarshalIndent(protocolSchema(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("static/protocol.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(got), want) {
+		t.Error("static/protocol.schema.json is stale; run go generate")
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	long := make([]byte, maxContentLength+1)
+	for i := range long {
+		long[i] = 'a'
+	}
+	for _, tc := range []struct {
+		protocol string
+		data     string
+		want     ClientFrame
+		code     ErrorCode
+	}{
+		{socketProtocol, `{"content":"Hi"}`, ClientFrame{Type: "message", Content: "Hi"}, ""},
+		{socketProtocol, `{"type":"read","id":"msg_1","extra":true}`, ClientFrame{Type: "read", ID: "msg_1"}, ""},
+		{socketProtocol, `not json`, ClientFrame{}, CodeInvalidPayload},
+		{socketProtocol, `{"type":"message","content":"  "}`, ClientFrame{}, CodeInvalidPayload},
+		{socketProtocol, `{"type":"message","content":"` + string(long) + `"}`, ClientFrame{}, CodeInvalidPayload},
+		{socketProtocol, `{"type":"watch","mode":"spy"}`, ClientFrame{}, CodeInvalidPayload},
+		{protocolV1, `{"v":1,"type":"message","id":"r1","payload":{"content":"Hi"}}`, ClientFrame{Type: "message", Ref: "r1", Content: "Hi"}, ""},
+		{protocolV1, `{"v":1,"type":"typing_start"}`, ClientFrame{Type: "typing_start"}, ""},
+		{protocolV1, `{"v":2,"type":"message","id":"r1","payload":{"content":"Hi"}}`, ClientFrame{Ref: "r1"}, CodeUnsupportedVersion},
+		{protocolV1, `{"v":1,"type":"message","payload":{"content":"Hi","colour":"red"}}`, ClientFrame{}, CodeInvalidPayload},
+		{protocolV1, `{"v":1,"type":"message","content":"Hi"}`, ClientFrame{}, CodeInvalidPayload},
+		{protocolV1, `{"v":1,"type":"delivered","payload":{}}`, ClientFrame{}, CodeInvalidPayload},
+		{protocolV1, `{"v":1,"type":"dance"}`, ClientFrame{}, CodeInvalidPayload},
+		{protocolV1, `{"content":"Hi"}`, ClientFrame{}, CodeInvalidPayload},
+	} {
+		frame, err := decodeFrame(tc.protocol, []byte(tc.data))
+		if tc.code == "" {
+			if err != nil || frame != tc.want {
+				t.Errorf("%s %s: expected %+v, got %+v (%v)", tc.protocol, tc.data, tc.want, frame, err)
+			}
+			continue
+		}
+		fe, ok := err.(*frameError)
+		if !ok || fe.code != tc.code {
+			t.Errorf("%s %s: expected %s, got %v", tc.protocol, tc.data, tc.code, err)
+		}
+		if tc.want.Ref != "" && frame.Ref != tc.want.Ref {
+			t.Errorf("%s %s: expected ref %q for the error, got %q", tc.protocol, tc.data, tc.want.Ref, frame.Ref)
+		}
+	}
+}
+
+func TestProtocolV1Envelopes(t *testing.T) {
+	hub := newTestHub(t)
+	alice := NewClient("Alice", "pt")
+	alice.Role = RoleCustomer
+	hub.AddClient(alice)
+	room := hub.CreateRoom(alice, "")
+	conn, read := dialProtocol(t, hub, "/ws?room_id="+room.ID, signedToken(t, alice), protocolV1)
+	if conn.Subprotocol() != protocolV1 {
+		t.Fatalf("expected %s to be negotiated, got %q", protocolV1, conn.Subprotocol())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn.Write(ctx, websocket.MessageText, []byte(`{"v":1,"type":"message","id":"m1","payload":{"content":"Olá"}}`))
+	frame := read()
+	payload, _ := frame["payload"].(map[string]any)
+	if frame["v"] != float64(1) || frame["type"] != "sent" || frame["id"] != "m1" || payload["id"] == nil {
+		t.Errorf("expected sent envelope answering m1, got %v", frame)
+	}
+
+	for _, tc := range []struct {
+		data string
+		id   string
+		code ErrorCode
+	}{
+		{`{"v":2,"type":"message","id":"m2","payload":{"content":"Olá"}}`, "m2", CodeUnsupportedVersion},
+		{`{"v":1,"type":"message","id":"m3","payload":{"text":"Olá"}}`, "m3", CodeInvalidPayload},
+		{`{"v":1,"type":"read","id":"m4","payload":{"id":"msg_unknown"}}`, "m4", CodeNotFound},
+		{`{"v":1,`, "", CodeInvalidPayload},
+	} {
+		conn.Write(ctx, websocket.MessageText, []byte(tc.data))
+		frame := read()
+		payload, _ := frame["payload"].(map[string]any)
+		if frame["type"] != "error" || payload["code"] != string(tc.code) || (tc.id != "" && frame["id"] != tc.id) {
+			t.Errorf("%s: expected %s error for %q, got %v", tc.data, tc.code, tc.id, frame)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// TranslationProvider is a translation backend. The Translator wraps a
+// provider with caching, so providers only need to talk to their backend.
+type TranslationProvider interface {
+	Translate(ctx context.Context, text string, fromLanguage string, toLanguage string) (string, error)
+	DetectLanguage(ctx context.Context, text string) (string, error)
+	Name() string
+	Health(ctx context.Context) error
+}
+
+// StreamingProvider is implemented by providers that can emit a translation
+// incrementally. onDelta is called with each new chunk as it arrives; the
+// full translation is returned at the end.
+type StreamingProvider interface {
+	TranslateStream(ctx context.Context, text string, fromLanguage string, toLanguage string, onDelta func(delta string)) (string, error)
+}
+
+// NewProvider builds the named provider from cfg.
+func NewProvider(name string, cfg Config) (TranslationProvider, error) {
+	switch name {
+	case "", "ollama":
+		return NewOllamaProvider(cfg.OllamaURL, cfg.OllamaModel), nil
+	case "openai":
+		return NewOpenAIProvider(cfg.OpenAIURL, cfg.OpenAIModel, cfg.OpenAIKey), nil
+	case "libretranslate":
+		return NewLibreTranslateProvider(cfg.LibreTranslateURL, cfg.LibreTranslateKey), nil
+	case "fake":
+		return NewFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown translation provider: %s", name)
+	}
+}
+
+// NewProviderChainFromConfig builds every provider in cfg.Providers, in
+// failover order.
+func NewProviderChainFromConfig(cfg Config) (*ProviderChain, error) {
+	var providers []TranslationProvider
+	for _, name := range cfg.Providers {
+		p, err := NewProvider(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no translation providers configured")
+	}
+	return NewProviderChain(providers, cfg.BreakerThreshold, cfg.BreakerCooldown, cfg.ProviderTimeout), nil
+}
+
+func translatePrompt(text string, fromLanguage string, toLanguage string) string {
+	return fmt.Sprintf("Translate the following text from %s to %s. Return ONLY the translation, nothing else: %s", fromLanguage, toLanguage, text)
+}
+
+func detectPrompt(text string) string {
+	return fmt.Sprintf("What language is this text? Reply with ONLY the ISO language code (e.g. en, pt, es, fr): %s", text)
+}
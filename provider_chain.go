@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var (
+	errAllProvidersUnavailable = errors.New("all translation providers are unavailable")
+	errPartialStream           = errors.New("stream failed after partial output")
+)
+
+type chainLink struct {
+	provider TranslationProvider
+	breaker  *CircuitBreaker
+}
+
+// ProviderChain tries providers in order, skipping any whose circuit
+// breaker is open. It implements TranslationProvider itself, so the
+// Translator doesn't need to know about failover.
+type ProviderChain struct {
+	links   []chainLink
+	timeout time.Duration
+}
+
+// ProviderStatus is the breaker state of one provider, reported by /health.
+type ProviderStatus struct {
+	Name     string       `json:"name"`
+	State    BreakerState `json:"state"`
+	Failures int          `json:"failures"`
+}
+
+func NewProviderChain(providers []TranslationProvider, threshold int, cooldown time.Duration, timeout time.Duration) *ProviderChain {
+	chain := &ProviderChain{timeout: timeout}
+	for _, p := range providers {
+		chain.links = append(chain.links, chainLink{
+			provider: p,
+			breaker:  NewCircuitBreaker(threshold, cooldown),
+		})
+	}
+	return chain
+}
+
+func (c *ProviderChain) Name() string {
+	var names []string
+	for _, link := range c.links {
+		names = append(names, link.provider.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// do runs call against each available provider until one succeeds.
+func (c *ProviderChain) do(ctx context.Context, call func(ctx context.Context, p TranslationProvider) (string, error)) (string, error) {
+	var errs []error
+	for _, link := range c.links {
+		if !link.breaker.Allow() {
+			continue
+		}
+
+		callCtx := ctx
+		cancel := func() {}
+		if c.timeout > 0 {
+			callCtx, cancel = context.WithTimeout(ctx, c.timeout)
+		}
+		result, err := call(callCtx, link.provider)
+		cancel()
+
+		if err == nil {
+			link.breaker.Success()
+			return result, nil
+		}
+		// A caller giving up isn't the backend's fault.
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		link.breaker.Failure()
+		slog.Warn("translation provider failed", "provider", link.provider.Name(), "state", link.breaker.State(), "error", err)
+		if errors.Is(err, errPartialStream) {
+			return "", err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", link.provider.Name(), err))
+	}
+	if len(errs) == 0 {
+		return "", errAllProvidersUnavailable
+	}
+	return "", errors.Join(append([]error{errAllProvidersUnavailable}, errs...)...)
+}
+
+func (c *ProviderChain) Translate(ctx context.Context, text string, fromLanguage string, toLanguage string) (string, error) {
+	return c.do(ctx, func(ctx context.Context, p TranslationProvider) (string, error) {
+		return p.Translate(ctx, text, fromLanguage, toLanguage)
+	})
+}
+
+// TranslateStream streams from the first available provider that supports
+// it; providers that don't are called normally and emit a single delta.
+// Once a provider has emitted deltas it is not failed over, since the
+// recipient has already seen partial output.
+func (c *ProviderChain) TranslateStream(ctx context.Context, text string, fromLanguage string, toLanguage string, onDelta func(delta string)) (string, error) {
+	return c.do(ctx, func(ctx context.Context, p TranslationProvider) (string, error) {
+		if sp, ok := p.(StreamingProvider); ok {
+			streamed := false
+			translated, err := sp.TranslateStream(ctx, text, fromLanguage, toLanguage, func(delta string) {
+				streamed = true
+				onDelta(delta)
+			})
+			if err != nil && streamed {
+				return "", fmt.Errorf("%w: %w", errPartialStream, err)
+			}
+			return translated, err
+		}
+		translated, err := p.Translate(ctx, text, fromLanguage, toLanguage)
+		if err == nil {
+			onDelta(translated)
+		}
+		return translated, err
+	})
+}
+
+func (c *ProviderChain) DetectLanguage(ctx context.Context, text string) (string, error) {
+	return c.do(ctx, func(ctx context.Context, p TranslationProvider) (string, error) {
+		return p.DetectLanguage(ctx, text)
+	})
+}
+
+// Health succeeds if at least one provider is healthy.
+func (c *ProviderChain) Health(ctx context.Context) error {
+	var errs []error
+	for _, link := range c.links {
+		err := link.provider.Health(ctx)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", link.provider.Name(), err))
+	}
+	return errors.Join(errs...)
+}
+
+// Status returns the breaker state of every provider, in chain order.
+func (c *ProviderChain) Status() []ProviderStatus {
+	var statuses []ProviderStatus
+	for _, link := range c.links {
+		statuses = append(statuses, ProviderStatus{
+			Name:     link.provider.Name(),
+			State:    link.breaker.State(),
+			Failures: link.breaker.Failures(),
+		})
+	}
+	return statuses
+}
+
+// Active returns the name of the first provider whose breaker isn't open,
+// i.e. the one currently serving requests.
+func (c *ProviderChain) Active() string {
+	for _, link := range c.links {
+		if link.breaker.State() != BreakerOpen {
+			return link.provider.Name()
+		}
+	}
+	return ""
+}
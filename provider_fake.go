@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FakeProvider is a deterministic provider for tests and local development.
+// Translations are "[to] text", detection returns a fixed language.
+type FakeProvider struct {
+	Language string
+	Err      error
+	Delay    time.Duration
+
+	mu    sync.Mutex
+	calls int
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{Language: "en"}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) DetectLanguage(ctx context.Context, text string) (string, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+	if p.Err != nil {
+		return "", p.Err
+	}
+	return p.Language, nil
+}
+
+func (p *FakeProvider) Translate(ctx context.Context, text string, fromLanguage string, toLanguage string) (string, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+	time.Sleep(p.Delay)
+	if p.Err != nil {
+		return "", p.Err
+	}
+	return fmt.Sprintf("[%s] %s", toLanguage, text), nil
+}
+
+func (p *FakeProvider) Health(ctx context.Context) error {
+	return p.Err
+}
+
+// Calls returns how many Translate and DetectLanguage calls were made.
+func (p *FakeProvider) Calls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// LibreTranslateProvider talks to a LibreTranslate-style REST API
+// (/translate, /detect, /languages).
+type LibreTranslateProvider struct {
+	client *http.Client
+	url    string
+	apiKey string
+}
+
+func NewLibreTranslateProvider(url string, apiKey string) *LibreTranslateProvider {
+	return &LibreTranslateProvider{
+		url:    url,
+		apiKey: apiKey,
+		client: &http.Client{Timeout: time.Second * 30},
+	}
+}
+
+func (p *LibreTranslateProvider) Name() string {
+	return "libretranslate"
+}
+
+func (p *LibreTranslateProvider) post(ctx context.Context, path string, reqBody map[string]any, result any) error {
+	if p.apiKey != "" {
+		reqBody["api_key"] = p.apiKey
+	}
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("libretranslate returned status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (p *LibreTranslateProvider) DetectLanguage(ctx context.Context, text string) (string, error) {
+	var result []struct {
+		Language   string  `json:"language"`
+		Confidence float64 `json:"confidence"`
+	}
+	if err := p.post(ctx, "/detect", map[string]any{"q": text}, &result); err != nil {
+		return "", err
+	}
+	if len(result) == 0 {
+		return "", fmt.Errorf("libretranslate could not detect a language")
+	}
+	return result[0].Language, nil
+}
+
+func (p *LibreTranslateProvider) Translate(ctx context.Context, text string, fromLanguage string, toLanguage string) (string, error) {
+	var result struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	reqBody := map[string]any{
+		"q":      text,
+		"source": fromLanguage,
+		"target": toLanguage,
+		"format": "text",
+	}
+	if err := p.post(ctx, "/translate", reqBody, &result); err != nil {
+		return "", err
+	}
+	return result.TranslatedText, nil
+}
+
+func (p *LibreTranslateProvider) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+"/languages", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("libretranslate returned status %d", resp.StatusCode)
+	}
+	return nil
+}
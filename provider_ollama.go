@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OllamaProvider talks to Ollama's /api/generate endpoint.
+type OllamaProvider struct {
+	client *http.Client
+	url    string
+	model  string
+}
+
+func NewOllamaProvider(url string, model string) *OllamaProvider {
+	return &OllamaProvider{
+		url:    url,
+		model:  model,
+		client: &http.Client{Timeout: time.Second * 30},
+	}
+}
+
+func (p *OllamaProvider) Name() string {
+	return "ollama"
+}
+
+func (p *OllamaProvider) post(ctx context.Context, prompt string, stream bool) (*http.Response, error) {
+	reqBody := map[string]any{
+		"model":  p.model,
+		"prompt": prompt,
+		"stream": stream,
+	}
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+"/api/generate", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("ollama returned status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+func (p *OllamaProvider) generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := p.post(ctx, prompt, false)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	var result struct {
+		Response string `json:"response"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	return result.Response, nil
+}
+
+// generateStream reads Ollama's NDJSON stream, one JSON object per line,
+// until it sees "done": true.
+func (p *OllamaProvider) generateStream(ctx context.Context, prompt string, onDelta func(delta string)) (string, error) {
+	resp, err := p.post(ctx, prompt, true)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	var full strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var chunk struct {
+			Response string `json:"response"`
+			Done     bool   `json:"done"`
+			Error    string `json:"error"`
+		}
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return "", err
+		}
+		if chunk.Error != "" {
+			return "", fmt.Errorf("ollama: %s", chunk.Error)
+		}
+		if chunk.Response != "" {
+			full.WriteString(chunk.Response)
+			onDelta(chunk.Response)
+		}
+		if chunk.Done {
+			return full.String(), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("ollama stream ended before completion")
+}
+
+func (p *OllamaProvider) DetectLanguage(ctx context.Context, text string) (string, error) {
+	return p.generate(ctx, detectPrompt(text))
+}
+
+func (p *OllamaProvider) Translate(ctx context.Context, text string, fromLanguage string, toLanguage string) (string, error) {
+	return p.generate(ctx, translatePrompt(text, fromLanguage, toLanguage))
+}
+
+func (p *OllamaProvider) TranslateStream(ctx context.Context, text string, fromLanguage string, toLanguage string, onDelta func(delta string)) (string, error) {
+	return p.generateStream(ctx, translatePrompt(text, fromLanguage, toLanguage), onDelta)
+}
+
+func (p *OllamaProvider) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+"/api/tags", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ollama returned status %d", resp.StatusCode)
+	}
+	return nil
+}
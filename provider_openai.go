@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// OpenAIProvider talks to any OpenAI-compatible /v1/chat/completions endpoint.
+type OpenAIProvider struct {
+	client *http.Client
+	url    string
+	model  string
+	apiKey string
+}
+
+func NewOpenAIProvider(url string, model string, apiKey string) *OpenAIProvider {
+	return &OpenAIProvider{
+		url:    url,
+		model:  model,
+		apiKey: apiKey,
+		client: &http.Client{Timeout: time.Second * 30},
+	}
+}
+
+func (p *OpenAIProvider) Name() string {
+	return "openai"
+}
+
+func (p *OpenAIProvider) newRequest(ctx context.Context, method string, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, p.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	return req, nil
+}
+
+func (p *OpenAIProvider) complete(ctx context.Context, prompt string) (string, error) {
+	reqBody := map[string]any{
+		"model": p.model,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+	}
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := p.newRequest(ctx, http.MethodPost, "/v1/chat/completions", body)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("openai returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("openai returned no choices")
+	}
+
+	return result.Choices[0].Message.Content, nil
+}
+
+func (p *OpenAIProvider) DetectLanguage(ctx context.Context, text string) (string, error) {
+	return p.complete(ctx, detectPrompt(text))
+}
+
+func (p *OpenAIProvider) Translate(ctx context.Context, text string, fromLanguage string, toLanguage string) (string, error) {
+	return p.complete(ctx, translatePrompt(text, fromLanguage, toLanguage))
+}
+
+func (p *OpenAIProvider) Health(ctx context.Context) error {
+	req, err := p.newRequest(ctx, http.MethodGet, "/v1/models", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("openai returned status %d", resp.StatusCode)
+	}
+	return nil
+}
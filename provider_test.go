@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewProviderUnknown(t *testing.T) {
+	if _, err := NewProvider("nope", Config{}); err == nil {
+		t.Fatal("expected error for unknown provider")
+	}
+}
+
+func TestOllamaProviderTranslate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/generate" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"response": "hello"})
+	}))
+	defer srv.Close()
+
+	got, err := NewOllamaProvider(srv.URL, "llama3.2").Translate(context.Background(), "olá", "pt", "en")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "hello" {
+		t.Errorf("expected hello, got %s", got)
+	}
+}
+
+func TestOpenAIProviderTranslate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("expected api key to be sent")
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hello"}}]}`))
+	}))
+	defer srv.Close()
+
+	got, err := NewOpenAIProvider(srv.URL, "gpt-4o-mini", "secret").Translate(context.Background(), "olá", "pt", "en")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "hello" {
+		t.Errorf("expected hello, got %s", got)
+	}
+}
+
+func TestLibreTranslateProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/translate":
+			w.Write([]byte(`{"translatedText":"hello"}`))
+		case "/detect":
+			w.Write([]byte(`[{"language":"pt","confidence":90}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	provider := NewLibreTranslateProvider(srv.URL, "")
+	got, err := provider.Translate(context.Background(), "olá", "pt", "en")
+	if err != nil || got != "hello" {
+		t.Errorf("expected hello, got %q (err %v)", got, err)
+	}
+	lang, err := provider.DetectLanguage(context.Background(), "olá")
+	if err != nil || lang != "pt" {
+		t.Errorf("expected pt, got %q (err %v)", lang, err)
+	}
+}
+
+func TestProviderErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if _, err := NewOllamaProvider(srv.URL, "llama3.2").Translate(context.Background(), "x", "pt", "en"); err == nil {
+		t.Fatal("expected error on 500 response")
+	}
+}
+
+func TestOllamaProviderTranslateStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"response":"hel","done":false}` + "\n"))
+		w.Write([]byte(`{"response":"lo","done":false}` + "\n"))
+		w.Write([]byte(`{"response":"","done":true}` + "\n"))
+	}))
+	defer srv.Close()
+
+	var deltas []string
+	got, err := NewOllamaProvider(srv.URL, "llama3.2").TranslateStream(context.Background(), "olá", "pt", "en", func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "hello" {
+		t.Errorf("expected hello, got %s", got)
+	}
+	if len(deltas) != 2 {
+		t.Errorf("expected 2 deltas, got %d", len(deltas))
+	}
+}
+
+func TestOllamaProviderStreamCutShort(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"response":"hel","done":false}` + "\n"))
+	}))
+	defer srv.Close()
+
+	_, err := NewOllamaProvider(srv.URL, "llama3.2").TranslateStream(context.Background(), "olá", "pt", "en", func(string) {})
+	if err == nil {
+		t.Fatal("expected error when stream ends without done")
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// assignment is a room handed to an agent by the queue. Notifications are
+// sent after h.mu is released.
+type assignment struct {
+	room  *Room
+	agent *Client
+}
+
+// SetAvailable marks an agent as ready (or not) to be assigned rooms.
+// Agents are offered rooms in the order they became available.
+func (h *Hub) SetAvailable(agent *Client, available bool) {
+	h.mu.Lock()
+	if available {
+		if _, ok := h.available[agent.Token]; !ok {
+			h.available[agent.Token] = time.Now()
+		}
+	} else {
+		delete(h.available, agent.Token)
+	}
+	h.emit(hubEvent{Kind: eventAvailability, Token: agent.Token, Online: available, Since: h.available[agent.Token]})
+	h.mu.Unlock()
+	slog.Info("agent availability changed", "agent", agent.Name, "available", available)
+	h.Assign()
+}
+
+func (h *Hub) IsAvailable(agentToken string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.available[agentToken]
+	return ok
+}
+
+// agentLoad counts the active rooms an agent is handling.
+// Callers must hold h.mu.
+func (h *Hub) agentLoad(agentToken string) int {
+	load := 0
+	for _, room := range h.Rooms {
+		if room.Agent != nil && room.Agent.Token == agentToken && room.Status == RoomActive {
+			load++
+		}
+	}
+	return load
+}
+
+// waitingRooms returns waiting rooms, oldest first. Callers must hold h.mu.
+func (h *Hub) waitingRooms() []*Room {
+	var rooms []*Room
+	for _, room := range h.Rooms {
+		if room.Status == RoomWaiting && room.Agent == nil {
+			rooms = append(rooms, room)
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].WaitingSince.Before(rooms[j].WaitingSince)
+	})
+	return rooms
+}
+
+// freeAgents returns the current load of every available agent with room
+// to spare. Callers must hold h.mu.
+func (h *Hub) freeAgents() map[*Client]int {
+	agents := make(map[*Client]int)
+	for token := range h.available {
+		agent, ok := h.Clients[token]
+		if !ok {
+			continue
+		}
+		if load := h.agentLoad(token); load < agent.capacity() {
+			agents[agent] = load
+		}
+	}
+	return agents
+}
+
+// matchScore ranks how well agent fits room: speaking the customer's
+// language natively beats having the topic skill, and both beat neither.
+func matchScore(room *Room, agent *Client) int {
+	score := 0
+	if room.Customer != nil && agent.Speaks(room.Customer.Language) {
+		score += 2
+	}
+	if room.Topic != "" && agent.HasSkill(room.Topic) {
+		score++
+	}
+	return score
+}
+
+// Assign hands each waiting room, oldest first, to the best-matching free
+// agent. Ties go to the least-loaded agent, then the one available
+// longest. Rooms still fall back to any free agent with translation, so
+// nobody waits for a perfect match. It's called whenever a room starts
+// waiting or an agent frees up, so nobody has to poll.
+func (h *Hub) Assign() {
+	h.mu.Lock()
+	var assignments []assignment
+	agents := h.freeAgents()
+	for _, room := range h.waitingRooms() {
+		if len(agents) == 0 {
+			break
+		}
+		if room.owner != h.instanceID {
+			continue
+		}
+		var agent *Client
+		for candidate := range agents {
+			if candidate.Token == room.TransferredFrom {
+				continue
+			}
+			if agent == nil || h.betterMatch(room, candidate, agent, agents) {
+				agent = candidate
+			}
+		}
+		if agent == nil {
+			continue
+		}
+		if err := h.setStatus(room, RoomActive); err != nil {
+			slog.Warn("failed to assign room", "room", room.ID, "error", err)
+			continue
+		}
+		room.Agent = agent
+		h.saveRoom(room)
+		agents[agent]++
+		if agents[agent] >= agent.capacity() {
+			delete(agents, agent)
+		}
+		assignments = append(assignments, assignment{room: room, agent: agent})
+		slog.Info("room assigned", "room", room.ID, "agent", agent.Name, "score", matchScore(room, agent))
+	}
+	h.mu.Unlock()
+
+	for _, a := range assignments {
+		h.notifyAssigned(a)
+	}
+}
+
+// betterMatch reports whether agent a should get room ahead of b.
+// Callers must hold h.mu.
+func (h *Hub) betterMatch(room *Room, a *Client, b *Client, loads map[*Client]int) bool {
+	if sa, sb := matchScore(room, a), matchScore(room, b); sa != sb {
+		return sa > sb
+	}
+	if loads[a] != loads[b] {
+		return loads[a] < loads[b]
+	}
+	if ta, tb := h.available[a.Token], h.available[b.Token]; !ta.Equal(tb) {
+		return ta.Before(tb)
+	}
+	return a.Token < b.Token
+}
+
+// assignedEvent tells an agent about a room they now handle, including
+// who transferred it to them and their note.
+func (h *Hub) assignedEvent(room *Room) []byte {
+	h.mu.Lock()
+	event := AssignedEvent{
+		Type:         "assigned",
+		RoomID:       room.ID,
+		CustomerName: room.Customer.Name,
+		CustomerID:   room.Customer.ID(),
+		Language:     room.Customer.Language,
+		Topic:        room.Topic,
+		Note:         room.TransferNote,
+	}
+	if from, ok := h.Clients[room.TransferredFrom]; ok {
+		event.TransferredFrom = from.Name
+	}
+	h.mu.Unlock()
+	data, _ := json.Marshal(event)
+	return data
+}
+
+func (h *Hub) notifyAssigned(a assignment) {
+	ctx := context.Background()
+	if err := h.Deliver(ctx, a.agent, h.assignedEvent(a.room)); err != nil {
+		slog.Error("failed to notify agent", "agent", a.agent.Name, "error", err)
+	}
+	if h.IsOnline(a.room.Customer) {
+		joined, _ := json.Marshal(RoomJoinedResponse{
+			Type:   "room_joined",
+			RoomID: a.room.ID,
+		})
+		h.Deliver(ctx, a.room.Customer, joined)
+	}
+}
+
+// AgentAtCapacity reports whether an agent already has as many active
+// rooms as they can take.
+func (h *Hub) AgentAtCapacity(agent *Client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.agentLoad(agent.Token) >= agent.capacity()
+}
+
+// AgentRooms returns the active rooms an agent is handling, oldest first.
+func (h *Hub) AgentRooms(agentToken string) []*Room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var rooms []*Room
+	for _, room := range h.Rooms {
+		if room.Agent != nil && room.Agent.Token == agentToken && room.Status == RoomActive {
+			rooms = append(rooms, room)
+		}
+	}
+	sortByCreated(rooms)
+	return rooms
+}
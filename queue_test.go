@@ -0,0 +1,168 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAssignOldestRoomFirst(t *testing.T) {
+	hub := newTestHub(t)
+	first := hub.CreateRoom(NewClient("Alice", ""), "")
+	time.Sleep(time.Millisecond)
+	second := hub.CreateRoom(NewClient("Carol", ""), "")
+
+	agent := NewClient("Bob", "en")
+	hub.AddClient(agent)
+	hub.SetAvailable(agent, true)
+
+	if first.Agent != agent || first.Status != RoomActive {
+		t.Fatalf("expected oldest room to be assigned to Bob, got %v / %s", first.Agent, first.Status)
+	}
+	if second.Status != RoomWaiting {
+		t.Errorf("expected second room to keep waiting, got %s", second.Status)
+	}
+}
+
+func TestAssignLongestAvailableAgentFirst(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	dave := NewClient("Dave", "en")
+	hub.AddClient(bob)
+	hub.AddClient(dave)
+	hub.SetAvailable(bob, true)
+	time.Sleep(time.Millisecond)
+	hub.SetAvailable(dave, true)
+
+	room := hub.CreateRoom(NewClient("Alice", ""), "")
+
+	if room.Agent != bob {
+		t.Errorf("expected Bob (available longest) to get the room, got %v", room.Agent.Name)
+	}
+}
+
+func TestAssignRespectsOneRoomPerAgent(t *testing.T) {
+	hub := newTestHub(t)
+	agent := NewClient("Bob", "en")
+	hub.AddClient(agent)
+	hub.SetAvailable(agent, true)
+
+	first := hub.CreateRoom(NewClient("Alice", ""), "")
+	second := hub.CreateRoom(NewClient("Carol", ""), "")
+
+	if first.Agent != agent {
+		t.Fatal("expected first room to be assigned")
+	}
+	if second.Status != RoomWaiting {
+		t.Fatalf("expected second room to wait while Bob is busy, got %s", second.Status)
+	}
+
+	// Finishing the first chat frees Bob for the next room in the queue.
+	hub.LeaveRoom(first)
+	if second.Agent != agent {
+		t.Errorf("expected second room to be assigned once Bob is free")
+	}
+}
+
+func TestUnavailableAgentNotAssigned(t *testing.T) {
+	hub := newTestHub(t)
+	agent := NewClient("Bob", "en")
+	hub.AddClient(agent)
+	hub.SetAvailable(agent, true)
+	hub.SetAvailable(agent, false)
+
+	room := hub.CreateRoom(NewClient("Alice", ""), "")
+
+	if room.Status != RoomWaiting {
+		t.Errorf("expected room to wait, got %s", room.Status)
+	}
+}
+
+func TestAssignPrefersAgentWhoSpeaksCustomerLanguage(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	ana := NewClient("Ana", "en")
+	ana.Languages = []string{"pt"}
+	hub.AddClient(bob)
+	hub.AddClient(ana)
+	hub.SetAvailable(bob, true)
+	time.Sleep(time.Millisecond)
+	hub.SetAvailable(ana, true)
+
+	room := hub.CreateRoom(NewClient("João", "pt-BR"), "")
+
+	if room.Agent != ana {
+		t.Errorf("expected Ana (speaks pt) over longer-available Bob, got %v", room.Agent.Name)
+	}
+}
+
+func TestAssignLanguageOutranksSkill(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	bob.Skills = []string{"billing"}
+	ana := NewClient("Ana", "es")
+	hub.AddClient(bob)
+	hub.AddClient(ana)
+	hub.SetAvailable(bob, true)
+	hub.SetAvailable(ana, true)
+
+	room := hub.CreateRoom(NewClient("Luis", "es"), "Billing")
+
+	if room.Agent != ana {
+		t.Errorf("expected Ana (speaks es) over Bob (billing), got %v", room.Agent.Name)
+	}
+}
+
+func TestAssignFallsBackToAnyFreeAgent(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	hub.AddClient(bob)
+	hub.SetAvailable(bob, true)
+
+	room := hub.CreateRoom(NewClient("Yuki", "ja"), "technical")
+
+	if room.Agent != bob {
+		t.Error("expected the room to go to Bob with translation rather than wait")
+	}
+}
+
+func TestAssignUpToAgentCapacity(t *testing.T) {
+	hub := newTestHub(t)
+	agent := NewClient("Bob", "en")
+	agent.MaxRooms = 2
+	hub.AddClient(agent)
+	hub.SetAvailable(agent, true)
+
+	first := hub.CreateRoom(NewClient("Alice", ""), "")
+	second := hub.CreateRoom(NewClient("Carol", ""), "")
+	third := hub.CreateRoom(NewClient("Dan", ""), "")
+
+	if first.Agent != agent || second.Agent != agent {
+		t.Fatal("expected Bob to take two rooms")
+	}
+	if third.Status != RoomWaiting {
+		t.Fatalf("expected third room to wait while Bob is at capacity, got %s", third.Status)
+	}
+
+	hub.LeaveRoom(first)
+	if third.Agent != agent {
+		t.Error("expected third room to be assigned once Bob has a free slot")
+	}
+}
+
+func TestAssignPrefersLeastLoadedAgent(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	dave := NewClient("Dave", "en")
+	bob.MaxRooms, dave.MaxRooms = 3, 3
+	hub.AddClient(bob)
+	hub.AddClient(dave)
+	hub.SetAvailable(bob, true)
+	hub.CreateRoom(NewClient("Alice", ""), "")
+	hub.SetAvailable(dave, true)
+
+	room := hub.CreateRoom(NewClient("Carol", ""), "")
+
+	if room.Agent != dave {
+		t.Errorf("expected Dave (no rooms) over Bob (one room), got %v", room.Agent.Name)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+var errUnknownMessage = errors.New("unknown message")
+
+// ReceiptStatus is how far a message has got with one recipient.
+type ReceiptStatus string
+
+const (
+	ReceiptDelivered ReceiptStatus = "delivered"
+	ReceiptRead      ReceiptStatus = "read"
+)
+
+// Receipt is one recipient's state for a message. Reading implies
+// delivery, so ReadAt is never set without DeliveredAt.
+type Receipt struct {
+	DeliveredAt time.Time `json:"delivered_at,omitzero"`
+	ReadAt      time.Time `json:"read_at,omitzero"`
+}
+
+// Acknowledge records that reader's socket received the message id in
+// room, or with ReceiptRead that they read it. A read also covers every
+// earlier message the reader could see, so clients only acknowledge the
+// newest one. It returns the messages whose receipts changed.
+func (h *Hub) Acknowledge(room *Room, reader *Client, id string, status ReceiptStatus) ([]ChatMessage, error) {
+	now := time.Now().UTC()
+	readerID := reader.ID()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	end := slices.IndexFunc(room.Messages, func(msg ChatMessage) bool { return msg.ID == id })
+	if end < 0 {
+		return nil, errUnknownMessage
+	}
+	start := end
+	if status == ReceiptRead {
+		start = 0
+	}
+
+	var changed []ChatMessage
+	for i := start; i <= end; i++ {
+		msg := &room.Messages[i]
+		if msg.SenderID == readerID || (msg.Type == "whisper" && reader == room.Customer) {
+			continue
+		}
+		receipt := msg.Receipts[readerID]
+		updated := receipt
+		if updated.DeliveredAt.IsZero() {
+			updated.DeliveredAt = now
+		}
+		if status == ReceiptRead && updated.ReadAt.IsZero() {
+			updated.ReadAt = now
+		}
+		if updated == receipt {
+			continue
+		}
+		// Copies of the message handed out earlier share the map, so
+		// replace it rather than writing into it.
+		receipts := maps.Clone(msg.Receipts)
+		if receipts == nil {
+			receipts = make(map[string]Receipt)
+		}
+		receipts[readerID] = updated
+		msg.Receipts = receipts
+		persist("update message", h.store.UpdateMessage(room.ID, *msg))
+		h.emit(hubEvent{Kind: eventMessageUpdated, RoomID: room.ID, Message: msg})
+		changed = append(changed, *msg)
+	}
+	return changed, nil
+}
+
+// acknowledge handles a "delivered" or "read" frame from reader and tells
+// the senders of the messages it covers, so an agent can see whether the
+// customer actually got their translated reply. An unknown id is answered
+// with an error echoing ref.
+func acknowledge(ctx context.Context, hub *Hub, room *Room, reader *Client, id string, status ReceiptStatus, ref string) {
+	changed, err := hub.Acknowledge(room, reader, id, status)
+	if err != nil {
+		sendError(ctx, hub, reader, ErrorResponse{Code: CodeNotFound, RoomID: room.ID, Ref: ref, Message: err.Error()})
+		return
+	}
+
+	readerID := reader.ID()
+	for _, msg := range changed {
+		hub.mu.Lock()
+		sender, ok := hub.clientByID(msg.SenderID)
+		online := ok && sender.Online
+		hub.mu.Unlock()
+		if !online {
+			continue
+		}
+
+		receipt := msg.Receipts[readerID]
+		event := ReceiptEvent{
+			Type:     "receipt",
+			RoomID:   room.ID,
+			ID:       msg.ID,
+			ClientID: readerID,
+			Status:   ReceiptDelivered,
+			At:       receipt.DeliveredAt,
+		}
+		if !receipt.ReadAt.IsZero() {
+			event.Status = ReceiptRead
+			event.At = receipt.ReadAt
+		}
+		data, _ := json.Marshal(event)
+		if err := hub.Deliver(ctx, sender, data); err != nil {
+			slog.Error("failed to send receipt", "recipient", sender.Name, "error", err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+func TestAddMessageAssignsSequence(t *testing.T) {
+	hub := newTestHub(t)
+	room := hub.CreateRoom(NewClient("Alice", "pt"), "")
+	first := hub.AddMessage(room, ChatMessage{Type: "message", RoomID: room.ID, Content: "Olá", ID: "client-chosen"})
+	second := hub.AddMessage(room, ChatMessage{Type: "message", RoomID: room.ID, Content: "Oi"})
+
+	if first.Seq != 1 || second.Seq != 2 {
+		t.Errorf("expected seq 1 and 2, got %d and %d", first.Seq, second.Seq)
+	}
+	if first.ID == "client-chosen" || first.ID == second.ID {
+		t.Errorf("expected distinct server-assigned IDs, got %q and %q", first.ID, second.ID)
+	}
+	if first.SentAt.IsZero() || second.SentAt.Before(first.SentAt) {
+		t.Errorf("expected ordered timestamps, got %v and %v", first.SentAt, second.SentAt)
+	}
+}
+
+func TestReceiptsReachSender(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	hub.AddClient(bob)
+	agentConn, agentRead := dialAgent(t, hub, bob)
+	alice := NewClient("Alice", "pt")
+	alice.Role = RoleCustomer
+	hub.AddClient(alice)
+	room := hub.CreateRoom(alice, "")
+	customerConn, customerRead := dialSocket(t, hub, "/ws?room_id="+room.ID, signedToken(t, room.Customer))
+	waitFor(t, "customer online", func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return room.Customer.Online
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if frame := agentRead(); frame["type"] != "assigned" {
+		t.Fatalf("expected assigned event, got %v", frame)
+	}
+	agentRead() // participant_connected for Alice
+	agentConn.Write(ctx, websocket.MessageText, []byte(`{"room_id":"`+room.ID+`","content":"Hello","ref":"r1"}`))
+	msg := customerRead()
+	id, _ := msg["id"].(string)
+	if id == "" || msg["seq"] != float64(1) || msg["sent_at"] == nil {
+		t.Fatalf("expected id, seq and sent_at on the message, got %v", msg)
+	}
+	if frame := agentRead(); frame["type"] != "sent" || frame["ref"] != "r1" || frame["id"] != id {
+		t.Fatalf("expected sent event matching ref r1 to %s, got %v", id, frame)
+	}
+
+	for _, status := range []string{"delivered", "read"} {
+		customerConn.Write(ctx, websocket.MessageText, []byte(`{"type":"`+status+`","id":"`+id+`"}`))
+		frame := agentRead()
+		if frame["type"] != "receipt" || frame["id"] != id || frame["status"] != status || frame["client_id"] != room.Customer.ID() {
+			t.Errorf("expected %s receipt, got %v", status, frame)
+		}
+	}
+
+	receipt := hub.History(room)[0].Receipts[room.Customer.ID()]
+	if receipt.DeliveredAt.IsZero() || receipt.ReadAt.IsZero() {
+		t.Errorf("expected receipt stored on the message, got %+v", receipt)
+	}
+
+	// Acknowledging again changes nothing, and the sender hears nothing.
+	if changed, err := hub.Acknowledge(room, room.Customer, id, ReceiptRead); err != nil || len(changed) != 0 {
+		t.Errorf("expected repeated read to be a no-op, got %v (%v)", changed, err)
+	}
+	if _, err := hub.Acknowledge(room, room.Customer, "msg_unknown", ReceiptRead); err != errUnknownMessage {
+		t.Errorf("expected errUnknownMessage, got %v", err)
+	}
+}
+
+func TestReadCoversEarlierMessages(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	customer := room.Customer
+	first := hub.AddMessage(room, ChatMessage{Type: "message", RoomID: room.ID, SenderID: bob.ID(), Content: "Hi"})
+	hub.AddMessage(room, ChatMessage{Type: "whisper", RoomID: room.ID, SenderID: "supervisor", Content: "psst"})
+	hub.AddMessage(room, ChatMessage{Type: "message", RoomID: room.ID, SenderID: customer.ID(), Content: "Olá"})
+	last := hub.AddMessage(room, ChatMessage{Type: "message", RoomID: room.ID, SenderID: bob.ID(), Content: "How can I help?"})
+
+	changed, err := hub.Acknowledge(room, customer, last.ID, ReceiptRead)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Whispers and the customer's own message aren't theirs to read.
+	if len(changed) != 2 || changed[0].ID != first.ID || changed[1].ID != last.ID {
+		t.Fatalf("expected the agent's two messages to be read, got %v", changed)
+	}
+	for _, msg := range hub.History(room) {
+		_, ok := msg.Receipts[customer.ID()]
+		if want := msg.ID == first.ID || msg.ID == last.ID; ok != want {
+			t.Errorf("message %s (%s): expected receipt %v", msg.ID, msg.Content, want)
+		}
+	}
+}
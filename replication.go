@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// hubTopic carries state changes between instances so every hub has the
+// same view of clients and rooms. clientTopic carries frames for one
+// client to whichever instance holds its WebSocket.
+const hubTopic = "hub"
+
+// statusReplaced closes a socket whose client has connected again, from a
+// reloaded page, another tab or another device. The newest socket wins.
+const statusReplaced websocket.StatusCode = 4000
+
+func clientTopic(token string) string {
+	return "client:" + token
+}
+
+type hubEventKind string
+
+const (
+	eventClientSaved    hubEventKind = "client_saved"
+	eventClientRemoved  hubEventKind = "client_removed"
+	eventRoomSaved      hubEventKind = "room_saved"
+	eventRoomRemoved    hubEventKind = "room_removed"
+	eventMessageAdded   hubEventKind = "message_added"
+	eventMessageUpdated hubEventKind = "message_updated"
+	eventPresence       hubEventKind = "presence"
+	eventAvailability   hubEventKind = "availability"
+	eventParticipants   hubEventKind = "participants"
+	eventRevoked        hubEventKind = "session_revoked"
+	eventTicketUsed     hubEventKind = "ticket_used"
+)
+
+type hubEvent struct {
+	Origin  string        `json:"origin"`
+	Kind    hubEventKind  `json:"kind"`
+	Client  *ClientRecord `json:"client,omitempty"`
+	Room    *RoomRecord   `json:"room,omitempty"`
+	RoomID  string        `json:"room_id,omitempty"`
+	Token   string        `json:"token,omitempty"`
+	Message *ChatMessage  `json:"message,omitempty"`
+	Online  bool          `json:"online,omitempty"`
+	Stream  bool          `json:"stream,omitempty"`
+	Since   time.Time     `json:"since,omitzero"`
+	Session string        `json:"session,omitempty"`
+	Ticket  string        `json:"ticket,omitempty"`
+	Until   time.Time     `json:"until,omitzero"`
+
+	Participants []participantRecord `json:"participants,omitempty"`
+}
+
+// eventQueueSize is how many hub events can wait to be published before
+// emit blocks.
+const eventQueueSize = 1024
+
+// emit queues a state change for the other instances. Callers hold h.mu,
+// which keeps events in the same order as the changes; publishEvents
+// sends them in that order without the lock, so a slow bus never holds
+// up the hub.
+func (h *Hub) emit(event hubEvent) {
+	event.Origin = h.instanceID
+	data, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("failed to encode hub event", "error", err)
+		return
+	}
+	h.events <- data
+}
+
+// publishEvents publishes the events emit queues, one at a time.
+func (h *Hub) publishEvents() {
+	for data := range h.events {
+		if err := h.bus.Publish(context.Background(), hubTopic, data); err != nil {
+			slog.Error("failed to publish hub event", "error", err)
+		}
+	}
+}
+
+// applyEvent mirrors a state change made by another instance. Remote
+// changes aren't written to the local store; the instance that made the
+// change has already persisted it.
+func (h *Hub) applyEvent(data []byte) {
+	var event hubEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		slog.Warn("invalid hub event", "error", err)
+		return
+	}
+	if event.Origin == h.instanceID {
+		return
+	}
+
+	h.mu.Lock()
+	h.applyEventLocked(event)
+	h.mu.Unlock()
+
+	// Remote changes can free an agent or add one to the pool, which may
+	// unblock rooms this instance owns.
+	switch event.Kind {
+	case eventRoomSaved, eventRoomRemoved, eventAvailability:
+		h.Assign()
+	case eventRevoked:
+		h.closeSession(event.Session)
+	}
+}
+
+func (h *Hub) applyEventLocked(event hubEvent) {
+	switch event.Kind {
+	case eventClientSaved:
+		if event.Client == nil {
+			return
+		}
+		if client, ok := h.Clients[event.Client.Token]; ok {
+			client.Name = event.Client.Name
+			client.Language = event.Client.Language
+			client.LanguageConfidence = event.Client.LanguageConfidence
+			client.LanguageSource = event.Client.LanguageSource
+			client.Role = event.Client.Role
+			client.Account = event.Client.Account
+			client.Languages = event.Client.Languages
+			client.Skills = event.Client.Skills
+			client.MaxRooms = event.Client.MaxRooms
+			return
+		}
+		h.Clients[event.Client.Token] = &Client{
+			Token:              event.Client.Token,
+			Name:               event.Client.Name,
+			Language:           event.Client.Language,
+			LanguageConfidence: event.Client.LanguageConfidence,
+			LanguageSource:     event.Client.LanguageSource,
+			Role:               event.Client.Role,
+			Account:            event.Client.Account,
+			Languages:          event.Client.Languages,
+			Skills:             event.Client.Skills,
+			MaxRooms:           event.Client.MaxRooms,
+			lastSeen:           time.Now(),
+			owner:              event.Origin,
+		}
+	case eventClientRemoved:
+		delete(h.Clients, event.Token)
+	case eventRoomSaved:
+		if event.Room == nil {
+			return
+		}
+		room, ok := h.Rooms[event.Room.ID]
+		if !ok {
+			customer, ok := h.Clients[event.Room.CustomerToken]
+			if !ok {
+				slog.Warn("room event for unknown customer", "room", event.Room.ID)
+				return
+			}
+			room = NewRoom(event.Room.ID, customer)
+			room.CreatedAt = event.Room.CreatedAt
+			room.owner = event.Origin
+			h.Rooms[room.ID] = room
+		}
+		if event.Room.Status == RoomWaiting && room.Status != RoomWaiting {
+			room.WaitingSince = time.Now()
+		}
+		room.Status = event.Room.Status
+		room.Agent = h.Clients[event.Room.AgentToken]
+		room.Topic = event.Room.Topic
+		room.TransferredFrom = event.Room.TransferredFrom
+		room.TransferNote = event.Room.TransferNote
+		// Only the instance that started the close timer may fire it.
+		if room.Status != RoomClosing {
+			h.cancelClose(room)
+		}
+	case eventRoomRemoved:
+		delete(h.Rooms, event.RoomID)
+	case eventMessageAdded:
+		if room, ok := h.Rooms[event.RoomID]; ok && event.Message != nil {
+			room.Messages = append(room.Messages, *event.Message)
+		}
+	case eventMessageUpdated:
+		room, ok := h.Rooms[event.RoomID]
+		if !ok || event.Message == nil {
+			return
+		}
+		for i := range room.Messages {
+			if room.Messages[i].ID == event.Message.ID {
+				room.Messages[i] = *event.Message
+			}
+		}
+	case eventParticipants:
+		room, ok := h.Rooms[event.RoomID]
+		if !ok {
+			return
+		}
+		room.Participants = nil
+		for _, p := range event.Participants {
+			if client, ok := h.Clients[p.Token]; ok {
+				room.Participants = append(room.Participants, &Participant{Client: client, Mode: p.Mode})
+			}
+		}
+	case eventAvailability:
+		if event.Online {
+			h.available[event.Token] = event.Since
+		} else {
+			delete(h.available, event.Token)
+		}
+	case eventRevoked:
+		h.revoked[event.Session] = event.Until
+	case eventTicketUsed:
+		h.usedTickets[event.Ticket] = event.Until
+	case eventPresence:
+		client, ok := h.Clients[event.Token]
+		if !ok {
+			return
+		}
+		if client.Connection != nil {
+			// Our socket outlives another instance's, but a new connection
+			// elsewhere replaces it.
+			if !event.Online {
+				return
+			}
+			h.replaceConnection(client)
+		}
+		client.Online = event.Online
+		client.Streaming = event.Stream
+	}
+}
+
+// Deliver sends a frame to a client, wherever it's connected. Frames for
+// local sockets are queued on their Outbox; otherwise the frame goes over
+// the bus to the instance holding the socket.
+func (h *Hub) Deliver(ctx context.Context, client *Client, data []byte) error {
+	if out := h.connection(client); out != nil {
+		return out.Send(data)
+	}
+	return h.bus.Publish(ctx, clientTopic(client.Token), data)
+}
+
+// connection returns client's local Outbox, or nil if their socket is on
+// another instance or closed.
+func (h *Hub) connection(client *Client) *Outbox {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return client.Connection
+}
+
+// IsOnline reports whether client has a socket open on any instance.
+func (h *Hub) IsOnline(client *Client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return client.Online
+}
+
+// Connect attaches a local WebSocket to a client, starting its Outbox, and
+// starts receiving frames sent to it from other instances. session is the token session it
+// authenticated with; revoking that session closes the socket. A socket
+// the client already had, here or on another instance, is closed with
+// statusReplaced. If the client was offline, its rooms are told it
+// connected.
+func (h *Hub) Connect(client *Client, conn *websocket.Conn, session string, streaming bool) {
+	unsubscribe, err := h.bus.Subscribe(clientTopic(client.Token), func(data []byte) {
+		if out := h.connection(client); out != nil {
+			if err := out.Send(data); err != nil {
+				slog.Error("failed to deliver bus frame", "client", client.Name, "error", err)
+			}
+		}
+	})
+	if err != nil {
+		slog.Error("failed to subscribe client topic", "client", client.Name, "error", err)
+	}
+
+	h.mu.Lock()
+	wasOnline := client.Online
+	h.replaceConnection(client)
+	client.Connection = newOutbox(conn, h.Outbound)
+	client.Streaming = streaming
+	client.Online = true
+	client.unsubscribe = unsubscribe
+	client.session = session
+	client.lastSeen = time.Now()
+	h.emit(hubEvent{Kind: eventPresence, Token: client.Token, Online: true, Stream: streaming})
+	h.mu.Unlock()
+
+	// A replaced socket hands over without the room seeing a gap.
+	if !wasOnline {
+		h.notifyPresence(client, true)
+	}
+}
+
+// Disconnect detaches conn from client and reports whether it was still
+// the client's socket, in which case its rooms are told it disconnected.
+// A replaced socket returns false, and its handler must leave cleanup
+// (availability, room membership) to the new one.
+func (h *Hub) Disconnect(client *Client, conn *websocket.Conn) bool {
+	h.mu.Lock()
+	if client.Connection == nil || client.Connection.conn != conn {
+		h.mu.Unlock()
+		return false
+	}
+	out := client.Connection
+	h.detach(client)
+	client.Online = false
+	h.emit(hubEvent{Kind: eventPresence, Token: client.Token, Online: false})
+	h.mu.Unlock()
+
+	// Frames queued before the handler gave up are written before it
+	// closes the socket.
+	out.drain()
+
+	h.notifyPresence(client, false)
+	return true
+}
+
+// replaceConnection closes client's local socket, if any, and detaches it
+// so its handler's Disconnect is a no-op. Callers must hold h.mu.
+func (h *Hub) replaceConnection(client *Client) {
+	old := client.Connection
+	if old == nil {
+		return
+	}
+	old.Close(statusReplaced, "connected from another session")
+	h.detach(client)
+	slog.Info("socket replaced by a newer connection", "client", client.Name)
+}
+
+// detach forgets client's local socket. Stopping its Outbox is up to the
+// caller: Close for a replaced socket, drain for one whose handler is
+// done with it. Callers must hold h.mu.
+func (h *Hub) detach(client *Client) {
+	client.Connection = nil
+	client.session = ""
+	client.lastSeen = time.Now()
+	if client.unsubscribe != nil {
+		client.unsubscribe()
+		client.unsubscribe = nil
+	}
+}
@@ -1,15 +1,15 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
-	"time"
-
-	"github.com/coder/websocket"
 )
 
+// handleRooms lists the queue, or with ?status=active the rooms that have
+// an agent, for supervisors to watch.
 func handleRooms(hub *Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -17,22 +17,46 @@ func handleRooms(hub *Hub) http.HandlerFunc {
 			return
 		}
 
-		rooms := hub.GetWaitingRooms()
+		var rooms []*Room
+		switch r.URL.Query().Get("status") {
+		case "", string(RoomWaiting):
+			rooms = hub.GetWaitingRooms()
+		case string(RoomActive):
+			rooms = hub.ActiveRooms()
+		default:
+			http.Error(w, "status must be waiting or active", http.StatusBadRequest)
+			return
+		}
 
 		type RoomInfo struct {
 			RoomID       string `json:"room_id"`
 			CustomerName string `json:"customer_name"`
 			Language     string `json:"language"`
+			// LanguageConfidence is how sure detection was of Language.
+			LanguageConfidence float64 `json:"language_confidence,omitempty"`
+			// LanguageSource says whether the customer declared Language
+			// or it was detected.
+			LanguageSource LanguageSource `json:"language_source,omitempty"`
+			Topic          string         `json:"topic,omitempty"`
+			AgentName      string         `json:"agent_name,omitempty"`
 		}
 
 		var result []RoomInfo
 
 		for _, room := range rooms {
-			result = append(result, RoomInfo{
-				RoomID:       room.ID,
-				CustomerName: room.Customer.Name,
-				Language:     room.Customer.Language,
-			})
+			customer := hub.Profile(room.Customer)
+			info := RoomInfo{
+				RoomID:             room.ID,
+				CustomerName:       customer.Name,
+				Language:           customer.Language,
+				LanguageConfidence: customer.LanguageConfidence,
+				LanguageSource:     customer.LanguageSource,
+				Topic:              room.Topic,
+			}
+			if agent := hub.RoomAgent(room); agent != nil {
+				info.AgentName = agent.Name
+			}
+			result = append(result, info)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -40,35 +64,231 @@ func handleRooms(hub *Hub) http.HandlerFunc {
 	}
 }
 
-func handleSetProfile(hub *Hub) http.HandlerFunc {
+// handleLogin checks staff credentials and returns a signed token carrying
+// the account's role. defaultMaxRooms applies to accounts that don't set
+// max_rooms.
+func handleLogin(hub *Hub, auth *Authenticator, defaultMaxRooms int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		var req SetProfileRequest
+		var req LoginRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "invalid json", http.StatusBadRequest)
 			return
 		}
 
-		if req.Name == "" || req.Language == "" {
-			http.Error(w, "name and language are required", http.StatusBadRequest)
+		account, err := auth.Login(req.Username, req.Password)
+		if err != nil {
+			slog.Warn("login failed", "username", req.Username)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		agent := NewClient(req.Name, req.Language)
-		hub.AddClient(agent)
+		client := hub.AccountClient(account, defaultMaxRooms)
+		token, expires, err := auth.Issue(client)
+		if err != nil {
+			http.Error(w, "failed to issue token", http.StatusInternalServerError)
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(SetProfileResponse{
-			Token: agent.Token,
+		json.NewEncoder(w).Encode(LoginResponse{
+			Token:     token,
+			Role:      client.Role,
+			Name:      client.Name,
+			ExpiresAt: expires,
+		})
+	}
+}
+
+// handleRefresh swaps a still-valid token for a new one in the same
+// session, so clients can stay signed in past AUTH_TOKEN_TTL.
+func handleRefresh(auth *Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		client := requestClient(r)
+		token, expires, err := auth.Refresh(client, requestClaims(r))
+		if err != nil {
+			http.Error(w, "failed to issue token", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LoginResponse{
+			Token:     token,
+			Role:      client.Role,
+			Name:      client.Name,
+			ExpiresAt: expires,
+		})
+	}
+}
+
+// handleLogout revokes the caller's session: the token, any token
+// refreshed from it, and any WebSocket opened with them.
+func handleLogout(hub *Hub, auth *Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth.Logout(hub, requestClaims(r))
+		slog.Info("logged out", "client", requestClient(r).Name)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleTicket issues a single-use WebSocket connect ticket for the
+// caller's session, to pass as ?ticket= instead of the token itself.
+func handleTicket(auth *Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ticket, expires, err := auth.IssueTicket(requestClient(r), requestClaims(r))
+		if err != nil {
+			http.Error(w, "failed to issue ticket", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TicketResponse{
+			Ticket:    ticket,
+			ExpiresAt: expires,
+		})
+	}
+}
+
+// handleCreateAccount lets an admin add a staff account.
+func handleCreateAccount(auth *Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req CreateAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		if req.Username == "" || req.Password == "" || req.Name == "" || req.Language == "" {
+			http.Error(w, "username, password, name and language are required", http.StatusBadRequest)
+			return
+		}
+		if req.Role == "" {
+			req.Role = RoleAgent
+		}
+		if !req.Role.AtLeast(RoleAgent) {
+			http.Error(w, "role must be agent, supervisor or admin", http.StatusBadRequest)
+			return
+		}
+
+		account, err := auth.CreateAccount(Account{
+			Username:  req.Username,
+			Role:      req.Role,
+			Name:      req.Name,
+			Language:  req.Language,
+			Languages: req.Languages,
+			Skills:    req.Skills,
+			MaxRooms:  req.MaxRooms,
+		}, req.Password)
+		switch {
+		case errors.Is(err, errAccountExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, "failed to create account", http.StatusInternalServerError)
+			return
+		}
+
+		slog.Info("account created", "username", account.Username, "role", account.Role)
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// handleSetProfile updates the logged-in staff member's profile. Fields
+// left empty keep their current value; languages must be valid BCP 47
+// tags and are stored in canonical form.
+func handleSetProfile(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		agent := requestClient(r)
+
+		var req SetProfileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		if req.Language != "" {
+			language, ok := canonicalLanguage(req.Language)
+			if !ok {
+				http.Error(w, "invalid language: "+req.Language, http.StatusBadRequest)
+				return
+			}
+			req.Language = language
+		}
+		for i, tag := range req.Languages {
+			language, ok := canonicalLanguage(tag)
+			if !ok {
+				http.Error(w, "invalid language: "+tag, http.StatusBadRequest)
+				return
+			}
+			req.Languages[i] = language
+		}
+
+		var resp SetProfileResponse
+		hub.UpdateClient(agent, func(agent *Client) {
+			if req.Name != "" {
+				agent.Name = req.Name
+			}
+			if req.Language != "" {
+				agent.Language = req.Language
+			}
+			if req.Languages != nil {
+				agent.Languages = req.Languages
+			}
+			if req.Skills != nil {
+				agent.Skills = req.Skills
+			}
+			if req.MaxRooms > 0 {
+				agent.MaxRooms = req.MaxRooms
+			}
+			resp = SetProfileResponse{
+				Name:      agent.Name,
+				Language:  agent.Language,
+				Languages: agent.Languages,
+				Skills:    agent.Skills,
+				MaxRooms:  agent.capacity(),
+			}
 		})
+		// A higher cap or new skills may make waiting rooms assignable.
+		hub.Assign()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
 	}
 }
 
-func handleStartChat(hub *Hub) http.HandlerFunc {
+// handleStartChat detects the customer's language from their first message
+// before queueing the room, so routing can pick an agent who speaks it.
+// The customer gets a signed token with the customer role.
+func handleStartChat(hub *Hub, translator *Translator, auth *Authenticator) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -86,50 +306,122 @@ func handleStartChat(hub *Hub) http.HandlerFunc {
 			return
 		}
 
-		customer := NewClient(req.Name, "")
+		var language string
+		if req.Language != "" {
+			var ok bool
+			if language, ok = canonicalLanguage(req.Language); !ok {
+				http.Error(w, "language must be a BCP 47 tag with an ISO 639 language, like pt or pt-BR", http.StatusBadRequest)
+				return
+			}
+		}
+
+		customer := NewClient(req.Name, language)
+		customer.Role = RoleCustomer
+		if language != "" {
+			customer.LanguageSource = LanguageDeclared
+		} else {
+			customerLanguage(r, translator, customer, req.Content)
+		}
 		hub.AddClient(customer)
 
-		room := hub.CreateRoom(customer)
-		msg := ChatMessage{
-			Type:    "message",
-			RoomID:  room.ID,
-			From:    customer.Name,
-			Content: req.Content,
+		token, resumeToken, expires, err := auth.IssueCustomer(customer)
+		if err != nil {
+			http.Error(w, "failed to issue token", http.StatusInternalServerError)
+			return
 		}
-		room.Messages = append(room.Messages, msg)
+
+		room := hub.CreateRoom(customer, strings.TrimSpace(req.Topic))
+		hub.AddMessage(room, ChatMessage{
+			Type:     "message",
+			RoomID:   room.ID,
+			From:     customer.Name,
+			SenderID: customer.ID(),
+			Content:  req.Content,
+			Language: customer.Language,
+		})
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(StartChatResponse{
-			Token:  customer.Token,
-			RoomID: room.ID,
+			Token:       token,
+			ResumeToken: resumeToken,
+			RoomID:      room.ID,
+			ClientID:    customer.ID(),
+			ExpiresAt:   expires,
 		})
 	}
 }
 
-func handleJoinRoom(hub *Hub) http.HandlerFunc {
+// customerLanguage sets a new customer's language from what they first
+// wrote. When detection isn't sure, the browser's Accept-Language wins.
+// Detection failing isn't fatal; detectLanguage retries on the customer's
+// next message.
+func customerLanguage(r *http.Request, translator *Translator, customer *Client, content string) {
+	detection, err := translator.Detect(r.Context(), content)
+	if err != nil {
+		slog.Warn("failed to detect language", "client", customer.Name, "error", err)
+	}
+	if browser := acceptLanguage(r.Header.Get("Accept-Language")); browser != "" && detection.Confidence < confidentDetection {
+		customer.Language = browser
+		customer.LanguageSource = LanguageBrowser
+		return
+	}
+	if detection.Language != "" {
+		customer.Language = detection.Language
+		customer.LanguageConfidence = detection.Confidence
+		customer.LanguageSource = LanguageDetected
+	}
+}
+
+// handleResume lets a customer back into their conversation with the
+// resume token from POST /start-chat, e.g. after a reload or on another
+// device. It returns a fresh bearer token; the page then reconnects to
+// /ws with last_id to replay what it missed.
+func handleResume(hub *Hub, auth *Authenticator) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-		if token == "" {
-			http.Error(w, "token required", http.StatusUnauthorized)
+		var req ResumeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		customer, token, expires, err := auth.Resume(hub, req.ResumeToken)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		agent, ok := hub.GetClient(token)
+		room, ok := hub.CustomerRoom(customer)
 		if !ok {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
+			http.Error(w, "conversation has ended", http.StatusNotFound)
 			return
 		}
 
-		if hub.IsAgentInRoom(agent.Token) {
-			http.Error(w, "already in a room", http.StatusConflict)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ResumeResponse{
+			Token:     token,
+			RoomID:    room.ID,
+			Status:    hub.RoomStatus(room),
+			Name:      customer.Name,
+			ClientID:  customer.ID(),
+			ExpiresAt: expires,
+		})
+	}
+}
+
+func handleJoinRoom(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
+		agent := requestClient(r)
+
 		var req RoomRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "invalid json", http.StatusBadRequest)
@@ -137,18 +429,22 @@ func handleJoinRoom(hub *Hub) http.HandlerFunc {
 		}
 
 		room, err := hub.JoinRoom(req.RoomID, agent)
+		if errors.Is(err, errAgentAtCapacity) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
 		// Notify the customer via WebSocket if they're connected
-		if room.Customer != nil && room.Customer.Connection != nil {
+		if room.Customer != nil && hub.IsOnline(room.Customer) {
 			notification, _ := json.Marshal(RoomJoinedResponse{
 				Type:   "room_joined",
 				RoomID: room.ID,
 			})
-			room.Customer.Connection.Write(r.Context(), websocket.MessageText, notification)
+			hub.Deliver(r.Context(), room.Customer, notification)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -166,17 +462,7 @@ func handleEndChat(hub *Hub) http.HandlerFunc {
 			return
 		}
 
-		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-		if token == "" {
-			http.Error(w, "token required", http.StatusUnauthorized)
-			return
-		}
-
-		client, ok := hub.GetClient(token)
-		if !ok {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
-			return
-		}
+		client := requestClient(r)
 
 		var req RoomRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -190,42 +476,26 @@ func handleEndChat(hub *Hub) http.HandlerFunc {
 			return
 		}
 
-		// Figure out who ended it and who needs to be notified
-		var reason string
-		var other *Client
-		if room.Customer != nil && room.Customer.Token == client.Token {
-			reason = "customer_left"
-			other = room.Agent
-			room.Status = RoomClosed
-			hub.RemoveRoom(room.ID)
-		} else {
-			reason = "agent_left"
-			other = room.Customer
-			room.Status = RoomClosing
-			room.Agent = nil
-
-			room.CloseTimer = time.AfterFunc(5*time.Minute, func() {
-				room.Status = RoomClosed
-				hub.RemoveRoom(room.ID)
-				if room.Customer != nil && room.Customer.Connection != nil {
-					notification, _ := json.Marshal(ChatEndedResponse{
-						Type:   "chat_ended",
-						RoomID: room.ID,
-						Reason: "closed",
-					})
-					room.Customer.Connection.Write(context.Background(), websocket.MessageText, notification)
-				}
-			})
+		// Agents can have several rooms, so this only ends the one named
+		// in the request.
+		reason, other, err := hub.EndChat(room, client)
+		switch {
+		case errors.Is(err, errNotInRoom):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
 		}
 
 		// Notify the other participant via WebSocket
-		if other != nil && other.Connection != nil {
+		if other != nil && hub.IsOnline(other) {
 			notification, _ := json.Marshal(ChatEndedResponse{
 				Type:   "chat_ended",
 				RoomID: room.ID,
 				Reason: reason,
 			})
-			other.Connection.Write(r.Context(), websocket.MessageText, notification)
+			hub.Deliver(r.Context(), other, notification)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -235,4 +505,140 @@ func handleEndChat(hub *Hub) http.HandlerFunc {
 			Reason: reason,
 		})
 	}
-}
\ No newline at end of file
+}
+
+func handleAvailability(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		agent := requestClient(r)
+
+		var req AvailabilityRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		hub.SetAvailable(agent, req.Available)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AvailabilityRequest{
+			Available: hub.IsAvailable(agent.Token),
+		})
+	}
+}
+
+// handleAgents lists available agents so one can pick a transfer target.
+func handleAgents(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(hub.Agents())
+	}
+}
+
+// handleTransfer moves a live room from the calling agent to another
+// agent, or back to the queue. The customer sees a "transferred" event
+// instead of chat_ended.
+func handleTransfer(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		agent := requestClient(r)
+
+		var req TransferRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		room, ok := hub.GetRoom(req.RoomID)
+		if !ok {
+			http.Error(w, "room not found", http.StatusNotFound)
+			return
+		}
+
+		var target *Client
+		if req.AgentID != "" {
+			target, ok = hub.AgentByID(req.AgentID)
+			if !ok {
+				http.Error(w, errAgentNotFound.Error(), http.StatusNotFound)
+				return
+			}
+		}
+
+		err := hub.TransferRoom(room, agent, target, strings.TrimSpace(req.Topic), req.Note)
+		switch {
+		case errors.Is(err, errNotRoomAgent):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		response := TransferredEvent{Type: "transferred", RoomID: room.ID}
+		if target != nil {
+			response.AgentName = target.Name
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// handleInvite lets a room's agent bring another staff member into the
+// conversation. The invitee gets an "invited" event on their socket.
+func handleInvite(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		agent := requestClient(r)
+
+		var req InviteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		room, ok := hub.GetRoom(req.RoomID)
+		if !ok {
+			http.Error(w, "room not found", http.StatusNotFound)
+			return
+		}
+
+		invitee, ok := hub.AgentByID(req.AgentID)
+		if !ok {
+			http.Error(w, errAgentNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		err := hub.Invite(room, agent, invitee, req.Note)
+		switch {
+		case errors.Is(err, errNotRoomAgent):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(InviteResponse{
+			RoomID:    room.ID,
+			AgentName: invitee.Name,
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+func TestResumeReplaysMissedMessages(t *testing.T) {
+	hub := newTestHub(t)
+	translator := NewTranslator(NewFakeProvider(), NewTranslationCache(CacheOptions{TTL: time.Minute}))
+
+	rec := httptest.NewRecorder()
+	body := `{"name":"Alice","content":"Olá, preciso de ajuda"}`
+	handleStartChat(hub, translator, testAuth)(rec, httptest.NewRequest(http.MethodPost, "/start-chat", strings.NewReader(body)))
+	var started StartChatResponse
+	json.NewDecoder(rec.Body).Decode(&started)
+	if started.ResumeToken == "" || started.ClientID == "" {
+		t.Fatalf("expected a resume token and client id, got %+v", started)
+	}
+
+	room, _ := hub.GetRoom(started.RoomID)
+	customer := room.Customer
+	agent := newTestAgent(hub)
+	hub.JoinRoom(room.ID, agent)
+	seen := room.Messages[0].ID
+	var ids []string
+	for _, msg := range []ChatMessage{
+		{Type: "message", From: "Bob", SenderID: agent.ID(), Content: "How can I help?", Language: "en"},
+		{Type: "whisper", From: "Bob", SenderID: agent.ID(), Content: "Looks like billing", Language: "en"},
+		{Type: "message", From: "Alice", SenderID: customer.ID(), Content: "Minha fatura", Language: customer.Language},
+		{Type: "message", From: "Bob", SenderID: agent.ID(), Content: "Let me check", Language: "en"},
+	} {
+		msg.RoomID = room.ID
+		ids = append(ids, hub.AddMessage(room, msg).ID)
+	}
+
+	// The bearer token is gone with the page; the resume token brings it back.
+	rec = httptest.NewRecorder()
+	body = `{"resume_token":"` + started.ResumeToken + `"}`
+	handleResume(hub, testAuth)(rec, httptest.NewRequest(http.MethodPost, "/resume", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resumed ResumeResponse
+	json.NewDecoder(rec.Body).Decode(&resumed)
+	if resumed.RoomID != room.ID || resumed.Status != RoomActive || resumed.ClientID != customer.ID() {
+		t.Fatalf("unexpected resume response: %+v", resumed)
+	}
+
+	_, read := dialSocket(t, hub, "/ws?room_id="+room.ID+"&last_id="+seen, resumed.Token)
+	// Whispers and the customer's own messages aren't replayed.
+	for _, want := range []string{ids[0], ids[3]} {
+		if frame := read(); frame["id"] != want || frame["sender_id"] != agent.ID() {
+			t.Errorf("expected replay of %s, got %v", want, frame)
+		}
+	}
+
+	// Bearer tokens can't stand in for resume tokens, nor the other way round.
+	rec = httptest.NewRecorder()
+	body = `{"resume_token":"` + started.Token + `"}`
+	handleResume(hub, testAuth)(rec, httptest.NewRequest(http.MethodPost, "/resume", strings.NewReader(body)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected bearer token to be refused by /resume, got %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+started.ResumeToken)
+	rec = httptest.NewRecorder()
+	testAuth.Require(hub, RoleCustomer, handleRefresh(testAuth))(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected resume token to be refused as a bearer token, got %d", rec.Code)
+	}
+}
+
+func TestNewSocketReplacesOld(t *testing.T) {
+	hub := newTestHub(t)
+	agent := newTestAgent(hub)
+	old, _ := dialAgent(t, hub, agent)
+	dialAgent(t, hub, agent)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		_, _, err := old.Read(ctx)
+		if err == nil {
+			continue
+		}
+		if websocket.CloseStatus(err) != statusReplaced {
+			t.Fatalf("expected old socket to be closed as replaced, got %v", err)
+		}
+		break
+	}
+
+	// Give the old handler time to run its cleanup; it mustn't touch the
+	// agent now that the new socket owns them.
+	time.Sleep(50 * time.Millisecond)
+	if !hub.IsAvailable(agent.Token) {
+		t.Error("expected agent to stay available on the new socket")
+	}
+}
@@ -1,6 +1,10 @@
 package main
 
-import "time"
+import (
+	"sort"
+	"sync"
+	"time"
+)
 
 type RoomStatus string
 
@@ -11,19 +15,84 @@ const (
 	RoomClosing RoomStatus = "closing"
 )
 
+// ParticipantMode is how a participant takes part in a room.
+type ParticipantMode string
+
+const (
+	// ModeMember is staff invited into the conversation, e.g. a second
+	// agent or a specialist.
+	ModeMember ParticipantMode = "member"
+	// ModeMonitor watches silently.
+	ModeMonitor ParticipantMode = "monitor"
+	// ModeWhisper talks to the agent; the customer never sees it.
+	ModeWhisper ParticipantMode = "whisper"
+	// ModeBarge joins the conversation and is translated for the customer.
+	ModeBarge ParticipantMode = "barge"
+)
+
+func validMode(mode ParticipantMode) bool {
+	return mode == ModeMonitor || mode == ModeWhisper || mode == ModeBarge
+}
+
+// Participant is someone in a room besides its customer and agent:
+// invited staff and supervisors.
+type Participant struct {
+	Client *Client
+	Mode   ParticipantMode
+}
+
 type Room struct {
-	ID              string
-	Customer        *Client
-	Agent           *Client
-	Status          RoomStatus
-	Messages   []ChatMessage
-	CloseTimer      *time.Timer
+	ID        string
+	Customer  *Client
+	Agent     *Client
+	Status    RoomStatus
+	Messages  []ChatMessage
+	CreatedAt time.Time
+	// WaitingSince is when the room last entered the queue; the oldest
+	// waiting room is assigned first.
+	WaitingSince time.Time
+	// Topic is what the customer asked for help with; agents with a
+	// matching skill are preferred.
+	Topic string
+	// TransferredFrom is the token of the agent who last handed the room
+	// on, and TransferNote their private note for the next agent. The
+	// queue won't give a transferred room back to TransferredFrom.
+	TransferredFrom string
+	TransferNote    string
+	// Participants are invited staff and supervisors, in the order they
+	// arrived. They're live-only and not persisted.
+	Participants []*Participant
+
+	// owner is the instance that created the room. Only the owner assigns
+	// it, so two instances never hand the same room to different agents.
+	owner string
+
+	// ops serializes lifecycle operations on the room (ending, leaving,
+	// reopening, the close timer), so each runs start to finish. It's
+	// taken before Hub.mu, never while holding it. Every field above is
+	// guarded by Hub.mu; status changes go through Hub.setStatus.
+	ops sync.Mutex
+	// closeTimer closes a RoomClosing room after roomCloseDelay. closeGen
+	// counts cancellations, so a timer that fires after being cancelled
+	// knows it's stale.
+	closeTimer *time.Timer
+	closeGen   int
 }
 
 func NewRoom(id string, customer *Client) *Room {
+	now := time.Now()
 	return &Room{
-		ID:       id,
-		Customer: customer,
-		Status:   RoomWaiting,
+		ID:           id,
+		Customer:     customer,
+		Status:       RoomWaiting,
+		CreatedAt:    now,
+		WaitingSince: now,
 	}
 }
+
+// sortByCreated orders rooms oldest first.
+func sortByCreated(rooms []*Room) {
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].CreatedAt.Before(rooms[j].CreatedAt)
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+var errNotInRoom = errors.New("you are not in this room")
+
+// roomTransitions is the room lifecycle. A room waits in the queue until
+// an agent takes it, goes back to waiting if the agent transfers it to
+// the queue, and starts closing when the agent leaves. A closing room
+// reopens into the queue if the customer writes again; otherwise its
+// close timer closes it. The customer leaving closes a room from any
+// state, and a closed room stays closed.
+var roomTransitions = map[RoomStatus][]RoomStatus{
+	RoomWaiting: {RoomActive, RoomClosed},
+	RoomActive:  {RoomWaiting, RoomClosing, RoomClosed},
+	RoomClosing: {RoomWaiting, RoomClosed},
+}
+
+// transitionError is a status change the lifecycle doesn't allow, usually
+// because another request changed the room first.
+type transitionError struct {
+	roomID   string
+	from, to RoomStatus
+}
+
+func (e *transitionError) Error() string {
+	return fmt.Sprintf("room %s is %s and can't become %s", e.roomID, e.from, e.to)
+}
+
+// setStatus moves a room to status if roomTransitions allows it, and
+// records and replicates the change. Leaving RoomClosing cancels the close
+// timer. Callers must hold h.mu.
+func (h *Hub) setStatus(room *Room, status RoomStatus) error {
+	from := room.Status
+	if !slices.Contains(roomTransitions[from], status) {
+		return &transitionError{roomID: room.ID, from: from, to: status}
+	}
+	room.Status = status
+	if status == RoomWaiting {
+		room.WaitingSince = time.Now()
+	}
+	if from == RoomClosing {
+		h.cancelClose(room)
+	}
+	persist("record transition", h.store.RecordTransition(room.ID, from, status))
+	h.saveRoom(room)
+	slog.Info("room transition", "room", room.ID, "from", from, "to", status)
+	return nil
+}
+
+// RoomStatus returns room's current status.
+func (h *Hub) RoomStatus(room *Room) RoomStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return room.Status
+}
+
+// RoomAgent returns room's current agent, or nil.
+func (h *Hub) RoomAgent(room *Room) *Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return room.Agent
+}
+
+// ReopenRoom puts a closing room back in the waiting list when the
+// customer writes again, cancelling its close timer.
+func (h *Hub) ReopenRoom(room *Room) error {
+	room.ops.Lock()
+	defer room.ops.Unlock()
+
+	h.mu.Lock()
+	if room.Status != RoomClosing {
+		h.mu.Unlock()
+		return &transitionError{roomID: room.ID, from: room.Status, to: RoomWaiting}
+	}
+	err := h.setStatus(room, RoomWaiting)
+	h.mu.Unlock()
+
+	h.Assign()
+	return err
+}
+
+// LeaveRoom removes the agent from an active room and starts the close
+// timer. The agent is free again, so the queue may hand them the next
+// room.
+func (h *Hub) LeaveRoom(room *Room) error {
+	room.ops.Lock()
+	defer room.ops.Unlock()
+
+	h.mu.Lock()
+	err := h.leaveRoom(room)
+	h.mu.Unlock()
+
+	h.Assign()
+	return err
+}
+
+// leaveRoom is LeaveRoom. Callers must hold room.ops and h.mu.
+func (h *Hub) leaveRoom(room *Room) error {
+	if err := h.setStatus(room, RoomClosing); err != nil {
+		return err
+	}
+	room.Agent = nil
+	room.TransferredFrom = ""
+	room.TransferNote = ""
+	h.saveRoom(room)
+	h.scheduleClose(room)
+	return nil
+}
+
+// EndChat handles client leaving room. The customer leaving closes it for
+// good; the agent leaving starts the close timer; invited staff and
+// supervisors step out and the chat goes on. It returns the reason to
+// report and who else should be told the chat ended, if anyone.
+func (h *Hub) EndChat(room *Room, client *Client) (reason string, other *Client, err error) {
+	room.ops.Lock()
+	defer room.ops.Unlock()
+
+	h.mu.Lock()
+	switch {
+	case room.Customer != nil && room.Customer.Token == client.Token:
+		reason, other = "customer_left", room.Agent
+		if err = h.setStatus(room, RoomClosed); err == nil {
+			h.removeRoom(room.ID)
+		}
+	case room.Agent != nil && room.Agent.Token == client.Token:
+		reason, other = "agent_left", room.Customer
+		err = h.leaveRoom(room)
+	case findParticipant(room, client) != nil:
+		h.mu.Unlock()
+		h.RemoveParticipant(room, client)
+		return "participant_left", nil, nil
+	default:
+		err = errNotInRoom
+	}
+	h.mu.Unlock()
+	if err != nil {
+		return "", nil, err
+	}
+
+	h.Assign()
+	return reason, other, nil
+}
+
+// scheduleClose closes the room after roomCloseDelay unless it's reopened
+// or removed first. Callers must hold h.mu.
+func (h *Hub) scheduleClose(room *Room) {
+	h.cancelClose(room)
+	gen := room.closeGen
+	room.closeTimer = time.AfterFunc(roomCloseDelay, func() { h.expireRoom(room, gen) })
+}
+
+// cancelClose stops room's close timer. A timer that already fired sees
+// the generation change and does nothing. Callers must hold h.mu.
+func (h *Hub) cancelClose(room *Room) {
+	room.closeGen++
+	if room.closeTimer != nil {
+		room.closeTimer.Stop()
+		room.closeTimer = nil
+	}
+}
+
+// expireRoom is the close timer: it closes and removes a room that is
+// still closing under the timer generation gen, and tells the customer.
+func (h *Hub) expireRoom(room *Room, gen int) {
+	room.ops.Lock()
+	defer room.ops.Unlock()
+
+	h.mu.Lock()
+	if room.closeGen != gen {
+		h.mu.Unlock()
+		return
+	}
+	room.closeTimer = nil
+	if err := h.setStatus(room, RoomClosed); err != nil {
+		h.mu.Unlock()
+		slog.Warn("close timer fired for a room that isn't closing", "room", room.ID, "error", err)
+		return
+	}
+	h.removeRoom(room.ID)
+	customer := room.Customer
+	online := customer != nil && customer.Online
+	h.mu.Unlock()
+
+	if online {
+		notification, _ := json.Marshal(ChatEndedResponse{
+			Type:   "chat_ended",
+			RoomID: room.ID,
+			Reason: "closed",
+		})
+		h.Deliver(context.Background(), customer, notification)
+	}
+	h.Assign()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRoomTransitionsAreGuarded(t *testing.T) {
+	hub := newTestHub(t)
+	agent := NewClient("Bob", "en")
+	room := hub.CreateRoom(NewClient("Alice", "pt"), "")
+	var transition *transitionError
+
+	if err := hub.ReopenRoom(room); !errors.As(err, &transition) {
+		t.Errorf("expected a waiting room not to reopen, got %v", err)
+	}
+	if err := hub.LeaveRoom(room); !errors.As(err, &transition) {
+		t.Errorf("expected leaving a waiting room to fail, got %v", err)
+	}
+	if _, err := hub.JoinRoom(room.ID, agent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := hub.JoinRoom(room.ID, NewClient("Dave", "en")); err == nil {
+		t.Error("expected a second agent not to join an active room")
+	}
+	if _, _, err := hub.EndChat(room, NewClient("Mallory", "en")); err != errNotInRoom {
+		t.Errorf("expected errNotInRoom, got %v", err)
+	}
+	if reason, other, err := hub.EndChat(room, agent); err != nil || reason != "agent_left" || other != room.Customer {
+		t.Fatalf("expected agent_left notifying the customer, got %q %v (%v)", reason, other, err)
+	}
+	if hub.RoomStatus(room) != RoomClosing || hub.RoomAgent(room) != nil {
+		t.Errorf("expected a closing room without an agent, got %s", hub.RoomStatus(room))
+	}
+
+	if reason, _, err := hub.EndChat(room, room.Customer); err != nil || reason != "customer_left" {
+		t.Fatalf("expected customer_left, got %q (%v)", reason, err)
+	}
+	if _, ok := hub.GetRoom(room.ID); ok {
+		t.Error("expected a closed room to be removed")
+	}
+	hub.mu.Lock()
+	err := hub.setStatus(room, RoomWaiting)
+	hub.mu.Unlock()
+	if !errors.As(err, &transition) {
+		t.Errorf("expected a closed room to stay closed, got %v", err)
+	}
+}
+
+func TestStaleCloseTimerIsIgnored(t *testing.T) {
+	hub := newTestHub(t)
+	room := hub.CreateRoom(NewClient("Alice", "pt"), "")
+	hub.JoinRoom(room.ID, NewClient("Bob", "en"))
+	hub.LeaveRoom(room)
+
+	hub.mu.Lock()
+	gen := room.closeGen
+	hub.mu.Unlock()
+	// The customer writes again just as the timer fires.
+	hub.ReopenRoom(room)
+	hub.expireRoom(room, gen)
+
+	if _, ok := hub.GetRoom(room.ID); !ok || hub.RoomStatus(room) != RoomWaiting {
+		t.Errorf("expected the reopened room to survive its old timer, got %s", hub.RoomStatus(room))
+	}
+}
+
+// TestRoomLifecycleRace hammers the same rooms with joins, leaves,
+// reopens, transfers, close timers and customers leaving, all at once.
+// Run it with -race; afterwards every room must have taken only allowed
+// transitions and be in a consistent state.
+func TestRoomLifecycleRace(t *testing.T) {
+	store := NewMemoryStore()
+	hub, _ := NewHub(store, NewLocalBus())
+	bob := NewClient("Bob", "en")
+	dave := NewClient("Dave", "en")
+	hub.AddClient(bob)
+	hub.AddClient(dave)
+
+	const rounds = 50
+	ops := []func(room *Room){
+		func(room *Room) { hub.JoinRoom(room.ID, bob) },
+		func(room *Room) { hub.JoinRoom(room.ID, dave) },
+		func(room *Room) { hub.EndChat(room, bob) },
+		func(room *Room) { hub.LeaveRoom(room) },
+		func(room *Room) { hub.ReopenRoom(room) },
+		func(room *Room) { hub.TransferRoom(room, dave, nil, "", "") },
+		func(room *Room) {
+			hub.mu.Lock()
+			gen := room.closeGen
+			hub.mu.Unlock()
+			hub.expireRoom(room, gen)
+		},
+		func(room *Room) {
+			hub.AddMessage(room, ChatMessage{Type: "message", RoomID: room.ID, Content: "hi"})
+			hub.History(room)
+			hub.RoomStatus(room)
+			hub.RoomAgent(room)
+		},
+	}
+
+	var rooms []*Room
+	for range 8 {
+		customer := NewClient("Alice", "pt")
+		hub.AddClient(customer)
+		rooms = append(rooms, hub.CreateRoom(customer, ""))
+	}
+
+	var wg sync.WaitGroup
+	for i, room := range rooms {
+		for _, op := range ops {
+			wg.Go(func() {
+				for range rounds {
+					op(room)
+				}
+			})
+		}
+		// Half the customers give up partway through.
+		if i%2 == 0 {
+			wg.Go(func() {
+				time.Sleep(time.Millisecond)
+				hub.EndChat(room, room.Customer)
+			})
+		}
+	}
+	wg.Wait()
+
+	for _, room := range rooms {
+		status := RoomWaiting
+		for _, tr := range store.Transitions(room.ID) {
+			if tr.From != status || !slices.Contains(roomTransitions[tr.From], tr.To) {
+				t.Fatalf("room %s: unexpected transition %s -> %s after %s", room.ID, tr.From, tr.To, status)
+			}
+			status = tr.To
+		}
+
+		current, agent := hub.RoomStatus(room), hub.RoomAgent(room)
+		if current != status {
+			t.Errorf("room %s: status %s, but last transition was to %s", room.ID, current, status)
+		}
+		if _, ok := hub.GetRoom(room.ID); ok == (current == RoomClosed) {
+			t.Errorf("room %s: %s, in the hub: %v", room.ID, current, ok)
+		}
+		// A closed room keeps the agent it ended with.
+		if current != RoomClosed && (agent != nil) != (current == RoomActive) {
+			t.Errorf("room %s: %s with agent %v", room.ID, current, agent)
+		}
+
+		for i, msg := range hub.History(room) {
+			if msg.Seq != int64(i+1) {
+				t.Errorf("room %s: message %d has seq %d", room.ID, i, msg.Seq)
+				break
+			}
+		}
+	}
+}
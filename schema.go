@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+//go:generate sh -c "go run . schema > static/protocol.schema.json"
+
+// serverFrames maps every frame type the server sends to its payload.
+var serverFrames = map[string]any{
+	"message":                  ChatMessage{},
+	"whisper":                  ChatMessage{},
+	"message_delta":            MessageDelta{},
+	"sent":                     SentEvent{},
+	"receipt":                  ReceiptEvent{},
+	"typing_start":             TypingEvent{},
+	"typing_stop":              TypingEvent{},
+	"participant_connected":    PresenceEvent{},
+	"participant_disconnected": PresenceEvent{},
+	"room_joined":              RoomJoinedResponse{},
+	"assigned":                 AssignedEvent{},
+	"invited":                  AssignedEvent{},
+	"transferred":              TransferredEvent{},
+	"watching":                 WatchingEvent{},
+	"language_changed":         LanguageChangedEvent{},
+	"chat_ended":               ChatEndedResponse{},
+	"authenticated":            AuthFrame{},
+	"error":                    ErrorResponse{},
+}
+
+// schemaEnums lists the values of the string types frames use as enums.
+var schemaEnums = map[reflect.Type][]string{
+	reflect.TypeFor[Role]():            {string(RoleCustomer), string(RoleAgent), string(RoleSupervisor), string(RoleAdmin)},
+	reflect.TypeFor[RoomStatus]():      {string(RoomWaiting), string(RoomActive), string(RoomClosing), string(RoomClosed)},
+	reflect.TypeFor[ParticipantMode](): {string(ModeMember), string(ModeMonitor), string(ModeWhisper), string(ModeBarge)},
+	reflect.TypeFor[ReceiptStatus]():   {string(ReceiptDelivered), string(ReceiptRead)},
+	reflect.TypeFor[LanguageSource]():  {string(LanguageDeclared), string(LanguageBrowser), string(LanguageDetected)},
+	reflect.TypeFor[ErrorCode](): {
+		string(CodeInvalidPayload), string(CodeUnsupportedVersion), string(CodeRateLimited), string(CodeRoomClosed),
+		string(CodeNotFound), string(CodeForbidden), string(CodeTranslationFailed),
+	},
+}
+
+// protocolSchema describes the chat.v1 protocol as a JSON Schema, built
+// from the frame types in message.go: a frame is either a ClientEnvelope
+// or a ServerEnvelope, each a oneOf keyed on the envelope's type. A field
+// is required unless it's tagged omitempty or omitzero.
+func protocolSchema() map[string]any {
+	defs := make(map[string]any)
+
+	var client []any
+	for _, kind := range slices.Sorted(maps.Keys(clientFrameFields)) {
+		payload := typeSchema(reflect.TypeFor[ClientFrame](), defs)
+		if required := clientFrameFields[kind]; len(required) > 0 {
+			payload = map[string]any{"allOf": []any{payload, map[string]any{"required": required}}}
+			client = append(client, envelopeSchema(kind, payload, true))
+			continue
+		}
+		client = append(client, envelopeSchema(kind, payload, false))
+	}
+	auth := typeSchema(reflect.TypeFor[AuthFrame](), defs)
+	client = append(client, envelopeSchema("auth", map[string]any{"allOf": []any{auth, map[string]any{"required": []string{"token"}}}}, true))
+
+	var server []any
+	for _, kind := range slices.Sorted(maps.Keys(serverFrames)) {
+		payload := typeSchema(reflect.TypeOf(serverFrames[kind]), defs)
+		server = append(server, envelopeSchema(kind, payload, true))
+	}
+
+	// The server rejects client payloads with fields it doesn't know.
+	defs["ClientFrame"].(map[string]any)["additionalProperties"] = false
+	defs["ClientEnvelope"] = map[string]any{"oneOf": client}
+	defs["ServerEnvelope"] = map[string]any{"oneOf": server}
+	return map[string]any{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         protocolV1,
+		"title":       "chat.v1 WebSocket protocol",
+		"description": fmt.Sprintf("Frames on a socket that negotiated the %q subprotocol. Generated from message.go by `go run . schema`; do not edit.", protocolV1),
+		"oneOf": []any{
+			map[string]any{"$ref": "#/$defs/ClientEnvelope"},
+			map[string]any{"$ref": "#/$defs/ServerEnvelope"},
+		},
+		"$defs": defs,
+	}
+}
+
+// envelopeSchema is an Envelope of the given type carrying payload.
+func envelopeSchema(kind string, payload any, payloadRequired bool) map[string]any {
+	required := []string{"v", "type"}
+	if payloadRequired {
+		required = append(required, "payload")
+	}
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"v":       map[string]any{"const": protocolVersion},
+			"type":    map[string]any{"const": kind},
+			"id":      map[string]any{"type": "string"},
+			"payload": payload,
+		},
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// typeSchema returns the schema for t, adding the structs it uses to defs
+// and referring to them by name.
+func typeSchema(t reflect.Type, defs map[string]any) map[string]any {
+	if enum, ok := schemaEnums[t]; ok {
+		return map[string]any{"type": "string", "enum": enum}
+	}
+	switch t {
+	case reflect.TypeFor[time.Time]():
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeFor[json.RawMessage]():
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Pointer:
+		return typeSchema(t.Elem(), defs)
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		if _, ok := defs[t.Name()]; !ok {
+			defs[t.Name()] = nil // guards against recursion
+			defs[t.Name()] = structSchema(t, defs)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	}
+	panic("schema: unsupported type " + t.String())
+}
+
+func structSchema(t reflect.Type, defs map[string]any) map[string]any {
+	properties := make(map[string]any)
+	required := []string{}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = typeSchema(field.Type, defs)
+		if !strings.Contains(options, "omitempty") && !strings.Contains(options, "omitzero") {
+			required = append(required, name)
+		}
+	}
+	return map[string]any{"type": "object", "properties": properties, "required": required}
+}
+
+// schemaCommand prints the protocol's JSON Schema, which is published as
+// static/protocol.schema.json:
+//
+//	go run . schema > static/protocol.schema.json
+func schemaCommand() {
+	data, err := json.MarshalIndent(protocolSchema(), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// RevokeSession makes every token in session invalid until until and
+// closes any WebSocket opened with one of them, on every instance.
+func (h *Hub) RevokeSession(session string, until time.Time) {
+	h.mu.Lock()
+	h.revoked[session] = until
+	persist("save revocation", h.store.SaveRevocation(session, until))
+	h.emit(hubEvent{Kind: eventRevoked, Session: session, Until: until})
+	h.mu.Unlock()
+
+	h.closeSession(session)
+}
+
+// IsRevoked reports whether session has been logged out.
+func (h *Hub) IsRevoked(session string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	until, ok := h.revoked[session]
+	return ok && h.now().Before(until)
+}
+
+// closeSession closes local sockets opened with a revoked session. The
+// close handshake can take a while, so it runs outside the lock and off
+// the caller's goroutine; the socket's handler cleans up as it exits.
+func (h *Hub) closeSession(session string) {
+	h.mu.Lock()
+	var outs []*Outbox
+	for _, client := range h.Clients {
+		if client.Connection != nil && client.session == session {
+			outs = append(outs, client.Connection)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, out := range outs {
+		out.Close(websocket.StatusPolicyViolation, "token revoked")
+	}
+}
+
+// ConsumeTicket spends a connect ticket, reporting false if it was
+// already used on any instance. until is when the ticket expires; after
+// that the signature check rejects it anyway and it can be forgotten.
+func (h *Hub) ConsumeTicket(id string, until time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, used := h.usedTickets[id]; used {
+		return false
+	}
+	h.usedTickets[id] = until
+	h.emit(hubEvent{Kind: eventTicketUsed, Ticket: id, Until: until})
+	return true
+}
+
+// Touch marks client as active, postponing the idle sweep.
+func (h *Hub) Touch(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	client.lastSeen = time.Now()
+}
+
+// SweepClients removes clients this instance created that are offline,
+// not available, in no room, and haven't been seen for idle. It also
+// forgets revocations and spent tickets that have expired. It returns how
+// many clients were removed.
+func (h *Hub) SweepClients(idle time.Duration) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	for session, until := range h.revoked {
+		if !now.Before(until) {
+			delete(h.revoked, session)
+		}
+	}
+	for id, until := range h.usedTickets {
+		if !now.Before(until) {
+			delete(h.usedTickets, id)
+		}
+	}
+
+	inRoom := make(map[string]bool)
+	for _, room := range h.Rooms {
+		if room.Customer != nil {
+			inRoom[room.Customer.Token] = true
+		}
+		if room.Agent != nil {
+			inRoom[room.Agent.Token] = true
+		}
+		for _, p := range room.Participants {
+			inRoom[p.Client.Token] = true
+		}
+	}
+
+	removed := 0
+	for token, client := range h.Clients {
+		if client.owner != h.instanceID || client.Online || inRoom[token] || now.Sub(client.lastSeen) < idle {
+			continue
+		}
+		if _, ok := h.available[token]; ok {
+			continue
+		}
+		h.removeClient(token)
+		removed++
+	}
+	return removed
+}
+
+// RunSweeper calls SweepClients every interval until ctx is done. A
+// non-positive interval disables sweeping.
+func (h *Hub) RunSweeper(ctx context.Context, every time.Duration, idle time.Duration) {
+	if every <= 0 {
+		return
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if removed := h.SweepClients(idle); removed > 0 {
+				slog.Info("idle clients swept", "removed", removed)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+func TestSweepClientsRemovesIdleClients(t *testing.T) {
+	hub := newTestHub(t)
+	idle := NewClient("Idle", "en")
+	waiting := NewClient("Alice", "pt")
+	online := NewClient("Bob", "en")
+	for _, c := range []*Client{idle, waiting, online} {
+		hub.AddClient(c)
+	}
+	hub.CreateRoom(waiting, "")
+	online.Online = true
+
+	// A client mirrored from another instance is that instance's to sweep.
+	remote := &Client{Token: "remote", Name: "Remote", owner: "other"}
+	hub.Clients[remote.Token] = remote
+
+	if removed := hub.SweepClients(time.Hour); removed != 0 {
+		t.Fatalf("expected nothing swept before the idle timeout, got %d", removed)
+	}
+
+	hub.mu.Lock()
+	for _, c := range hub.Clients {
+		c.lastSeen = time.Now().Add(-2 * time.Hour)
+	}
+	hub.mu.Unlock()
+
+	if removed := hub.SweepClients(time.Hour); removed != 1 {
+		t.Fatalf("expected 1 client swept, got %d", removed)
+	}
+	if _, ok := hub.GetClient(idle.Token); ok {
+		t.Error("expected idle client to be removed")
+	}
+	for _, c := range []*Client{waiting, online, remote} {
+		if _, ok := hub.GetClient(c.Token); !ok {
+			t.Errorf("expected %s to be kept", c.Name)
+		}
+	}
+}
+
+func TestLogoutRevokesSessionAndClosesSocket(t *testing.T) {
+	hub := newTestHub(t)
+	agent := NewClient("Bob", "en")
+	agent.Role = RoleAgent
+	hub.AddClient(agent)
+
+	token := signedToken(t, agent)
+	claims, _ := testAuth.Verify(token)
+	refreshed, _, err := testAuth.Refresh(agent, claims)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conn, _ := dialSocket(t, hub, "/agent-ws", token)
+	waitFor(t, "agent online", func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return agent.Online
+	})
+
+	call := func(handler http.HandlerFunc, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		testAuth.Require(hub, RoleCustomer, handler)(rec, req)
+		return rec
+	}
+
+	rec := call(handleRefresh(testAuth), refreshed)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected refresh to succeed, got %d", rec.Code)
+	}
+	var resp LoginResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if c, _ := testAuth.Verify(resp.Token); c.Session != claims.Session {
+		t.Error("expected refreshed token to keep the session")
+	}
+
+	if rec := call(handleLogout(hub, testAuth), token); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected logout to succeed, got %d", rec.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, _, err := conn.Read(ctx); websocket.CloseStatus(err) != websocket.StatusPolicyViolation {
+		t.Errorf("expected socket closed with policy violation, got %v", err)
+	}
+	for _, tok := range []string{token, refreshed, resp.Token} {
+		if rec := call(handleRefresh(testAuth), tok); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected revoked session token to be rejected, got %d", rec.Code)
+		}
+	}
+}
+
+func TestLogoutOutlastsResumeToken(t *testing.T) {
+	hub := newTestHub(t)
+	customer := NewClient("Alice", "pt")
+	hub.AddClient(customer)
+	hub.CreateRoom(customer, "")
+
+	token, resumeToken, _, err := testAuth.IssueCustomer(customer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	claims, _ := testAuth.Verify(token)
+	testAuth.Logout(hub, claims)
+
+	// Every bearer token in the session has expired and the sweeper has
+	// run, but the resume token is still good.
+	hub.now = func() time.Time { return time.Now().Add(testAuth.ttl + time.Minute) }
+	hub.SweepClients(time.Hour)
+
+	body, _ := json.Marshal(ResumeRequest{ResumeToken: resumeToken})
+	rec := httptest.NewRecorder()
+	handleResume(hub, testAuth)(rec, httptest.NewRequest(http.MethodPost, "/resume", bytes.NewReader(body)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected resume after logout to be refused, got %d", rec.Code)
+	}
+}
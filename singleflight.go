@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// errFlightPanicked is what waiters get when the call they waited on
+// panicked.
+var errFlightPanicked = errors.New("coalesced call panicked")
+
+// flightCall is one in-progress call that other callers can wait on.
+type flightCall struct {
+	wg  sync.WaitGroup
+	val string
+	err error
+}
+
+// flightGroup coalesces concurrent calls with the same key so only one of
+// them does the work and the rest share its result.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// Do runs fn once per key at a time. shared is true for callers that
+// waited on someone else's call instead of running fn themselves. If fn
+// panics, the panic carries on in the caller that ran it and the waiters
+// get errFlightPanicked.
+func (g *flightGroup) Do(key string, fn func() (string, error)) (val string, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.val, call.err, true
+	}
+	call := &flightCall{err: errFlightPanicked}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		call.wg.Done()
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+	}()
+	call.val, call.err = fn()
+	return call.val, call.err, false
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ClientRecord is the persisted part of a Client (no live connection).
+type ClientRecord struct {
+	Token    string
+	Name     string
+	Language string
+	// LanguageConfidence is Client.LanguageConfidence.
+	LanguageConfidence float64
+	LanguageSource     LanguageSource
+	Role               Role
+	Account            string
+	Languages          []string
+	Skills             []string
+	MaxRooms           int
+}
+
+// RoomRecord is the persisted part of a Room. The customer and agent are
+// stored by token and resolved against the client records on load.
+// Invited participants aren't persisted.
+type RoomRecord struct {
+	ID            string
+	CustomerToken string
+	AgentToken    string
+	Status        RoomStatus
+	Topic         string
+	// TransferredFrom and TransferNote carry the last warm transfer.
+	TransferredFrom string
+	TransferNote    string
+	CreatedAt       time.Time
+}
+
+// Snapshot is everything a Store holds, used to rehydrate the Hub.
+type Snapshot struct {
+	Clients  []ClientRecord
+	Rooms    []RoomRecord
+	Messages map[string][]ChatMessage
+	// Revocations maps revoked token sessions to when their last token
+	// expires.
+	Revocations map[string]time.Time
+}
+
+// Store persists hub state so conversations survive a restart.
+type Store interface {
+	SaveClient(client ClientRecord) error
+	DeleteClient(token string) error
+	SaveRoom(room RoomRecord) error
+	// DeleteRoom removes a room. Its messages and transitions are kept for
+	// auditing, but Load no longer returns them.
+	DeleteRoom(roomID string) error
+	RecordTransition(roomID string, from RoomStatus, to RoomStatus) error
+	AppendMessage(roomID string, msg ChatMessage) error
+	// UpdateMessage replaces the stored message with msg's ID, e.g. to
+	// record receipts.
+	UpdateMessage(roomID string, msg ChatMessage) error
+	SaveAccount(account Account) error
+	LoadAccounts() ([]Account, error)
+	SaveRevocation(session string, until time.Time) error
+	Load() (Snapshot, error)
+	Close() error
+}
+
+// RoomTransition is one recorded status change.
+type RoomTransition struct {
+	RoomID string
+	From   RoomStatus
+	To     RoomStatus
+	At     time.Time
+}
+
+// MemoryStore keeps everything in maps. It's the default when no database
+// is configured, and lets tests exercise rehydration without SQLite.
+type MemoryStore struct {
+	mu          sync.Mutex
+	clients     map[string]ClientRecord
+	rooms       map[string]RoomRecord
+	messages    map[string][]ChatMessage
+	transitions []RoomTransition
+	accounts    map[string]Account
+	revocations map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		clients:     make(map[string]ClientRecord),
+		rooms:       make(map[string]RoomRecord),
+		messages:    make(map[string][]ChatMessage),
+		accounts:    make(map[string]Account),
+		revocations: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryStore) SaveClient(client ClientRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[client.Token] = client
+	return nil
+}
+
+func (s *MemoryStore) DeleteClient(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, token)
+	return nil
+}
+
+func (s *MemoryStore) SaveRoom(room RoomRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rooms[room.ID] = room
+	return nil
+}
+
+func (s *MemoryStore) DeleteRoom(roomID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rooms, roomID)
+	return nil
+}
+
+func (s *MemoryStore) RecordTransition(roomID string, from RoomStatus, to RoomStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transitions = append(s.transitions, RoomTransition{RoomID: roomID, From: from, To: to, At: time.Now()})
+	return nil
+}
+
+func (s *MemoryStore) AppendMessage(roomID string, msg ChatMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages[roomID] = append(s.messages[roomID], msg)
+	return nil
+}
+
+func (s *MemoryStore) UpdateMessage(roomID string, msg ChatMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, stored := range s.messages[roomID] {
+		if stored.ID == msg.ID {
+			s.messages[roomID][i] = msg
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) SaveAccount(account Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts[account.Username] = account
+	return nil
+}
+
+func (s *MemoryStore) LoadAccounts() ([]Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var accounts []Account
+	for _, a := range s.accounts {
+		accounts = append(accounts, a)
+	}
+	return accounts, nil
+}
+
+func (s *MemoryStore) SaveRevocation(session string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revocations[session] = until
+	return nil
+}
+
+func (s *MemoryStore) Transitions(roomID string) []RoomTransition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []RoomTransition
+	for _, t := range s.transitions {
+		if t.RoomID == roomID {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func (s *MemoryStore) Load() (Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := Snapshot{Messages: make(map[string][]ChatMessage), Revocations: make(map[string]time.Time)}
+	now := time.Now()
+	for session, until := range s.revocations {
+		if until.After(now) {
+			snapshot.Revocations[session] = until
+		}
+	}
+	for _, c := range s.clients {
+		snapshot.Clients = append(snapshot.Clients, c)
+	}
+	for _, r := range s.rooms {
+		snapshot.Rooms = append(snapshot.Rooms, r)
+	}
+	for id, msgs := range s.messages {
+		if _, ok := s.rooms[id]; ok {
+			snapshot.Messages[id] = append([]ChatMessage(nil), msgs...)
+		}
+	}
+	return snapshot, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
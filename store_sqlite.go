@@ -0,0 +1,287 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS clients (
+	token               TEXT PRIMARY KEY,
+	name                TEXT NOT NULL,
+	language            TEXT NOT NULL DEFAULT '',
+	languages           TEXT NOT NULL DEFAULT '[]',
+	skills              TEXT NOT NULL DEFAULT '[]',
+	max_rooms           INTEGER NOT NULL DEFAULT 0,
+	role                TEXT NOT NULL DEFAULT '',
+	account             TEXT NOT NULL DEFAULT '',
+	language_confidence REAL NOT NULL DEFAULT 0,
+	language_source     TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS rooms (
+	id               TEXT PRIMARY KEY,
+	customer_token   TEXT NOT NULL,
+	agent_token      TEXT NOT NULL DEFAULT '',
+	status           TEXT NOT NULL,
+	created_at       TIMESTAMP NOT NULL,
+	topic            TEXT NOT NULL DEFAULT '',
+	transferred_from TEXT NOT NULL DEFAULT '',
+	transfer_note    TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS room_transitions (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id     TEXT NOT NULL,
+	from_status TEXT NOT NULL,
+	to_status   TEXT NOT NULL,
+	at          TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id    TEXT NOT NULL,
+	data       TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	message_id TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS messages_room ON messages (room_id, seq);
+CREATE INDEX IF NOT EXISTS messages_id ON messages (room_id, message_id);
+
+CREATE TABLE IF NOT EXISTS accounts (
+	username TEXT PRIMARY KEY,
+	data     TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS revoked_sessions (
+	session TEXT PRIMARY KEY,
+	until   TIMESTAMP NOT NULL
+);
+`
+
+// SQLiteStore persists hub state in an embedded SQLite database. Messages
+// are stored as JSON so new ChatMessage fields don't need a migration.
+// Deleting a room keeps its messages and transitions for auditing.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time; a single connection avoids
+	// "database is locked" errors under concurrent handlers.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) SaveClient(client ClientRecord) error {
+	languages, _ := json.Marshal(client.Languages)
+	skills, _ := json.Marshal(client.Skills)
+	_, err := s.db.Exec(
+		`INSERT INTO clients (token, name, language, language_confidence, language_source, role, account, languages, skills, max_rooms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(token) DO UPDATE SET name = excluded.name, language = excluded.language, language_confidence = excluded.language_confidence,
+		 language_source = excluded.language_source, role = excluded.role, account = excluded.account, languages = excluded.languages, skills = excluded.skills, max_rooms = excluded.max_rooms`,
+		client.Token, client.Name, client.Language, client.LanguageConfidence, string(client.LanguageSource), string(client.Role), client.Account, string(languages), string(skills), client.MaxRooms,
+	)
+	return err
+}
+
+// SaveAccount stores an account as JSON, keyed by username.
+func (s *SQLiteStore) SaveAccount(account Account) error {
+	data, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO accounts (username, data) VALUES (?, ?)
+		 ON CONFLICT(username) DO UPDATE SET data = excluded.data`,
+		account.Username, string(data),
+	)
+	return err
+}
+
+func (s *SQLiteStore) LoadAccounts() ([]Account, error) {
+	rows, err := s.db.Query(`SELECT data FROM accounts ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var accounts []Account
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var account Account
+		if err := json.Unmarshal([]byte(data), &account); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// SaveRevocation records a revoked session and drops revocations whose
+// tokens have all expired.
+func (s *SQLiteStore) SaveRevocation(session string, until time.Time) error {
+	if _, err := s.db.Exec(`DELETE FROM revoked_sessions WHERE until <= ?`, time.Now().UTC()); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(
+		`INSERT INTO revoked_sessions (session, until) VALUES (?, ?)
+		 ON CONFLICT(session) DO UPDATE SET until = excluded.until`,
+		session, until.UTC(),
+	)
+	return err
+}
+
+func (s *SQLiteStore) DeleteClient(token string) error {
+	_, err := s.db.Exec(`DELETE FROM clients WHERE token = ?`, token)
+	return err
+}
+
+func (s *SQLiteStore) SaveRoom(room RoomRecord) error {
+	_, err := s.db.Exec(
+		`INSERT INTO rooms (id, customer_token, agent_token, status, topic, transferred_from, transfer_note, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(id) DO UPDATE SET customer_token = excluded.customer_token,
+		 agent_token = excluded.agent_token, status = excluded.status, topic = excluded.topic,
+		 transferred_from = excluded.transferred_from, transfer_note = excluded.transfer_note`,
+		room.ID, room.CustomerToken, room.AgentToken, string(room.Status), room.Topic,
+		room.TransferredFrom, room.TransferNote, room.CreatedAt.UTC(),
+	)
+	return err
+}
+
+func (s *SQLiteStore) DeleteRoom(roomID string) error {
+	_, err := s.db.Exec(`DELETE FROM rooms WHERE id = ?`, roomID)
+	return err
+}
+
+func (s *SQLiteStore) RecordTransition(roomID string, from RoomStatus, to RoomStatus) error {
+	_, err := s.db.Exec(
+		`INSERT INTO room_transitions (room_id, from_status, to_status, at) VALUES (?, ?, ?, ?)`,
+		roomID, string(from), string(to), time.Now().UTC(),
+	)
+	return err
+}
+
+func (s *SQLiteStore) AppendMessage(roomID string, msg ChatMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO messages (room_id, message_id, data, created_at) VALUES (?, ?, ?, ?)`,
+		roomID, msg.ID, string(data), time.Now().UTC(),
+	)
+	return err
+}
+
+func (s *SQLiteStore) UpdateMessage(roomID string, msg ChatMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		`UPDATE messages SET data = ? WHERE room_id = ? AND message_id = ?`,
+		string(data), roomID, msg.ID,
+	)
+	return err
+}
+
+func (s *SQLiteStore) Load() (Snapshot, error) {
+	snapshot := Snapshot{Messages: make(map[string][]ChatMessage), Revocations: make(map[string]time.Time)}
+
+	rows, err := s.db.Query(`SELECT session, until FROM revoked_sessions WHERE until > ?`, time.Now().UTC())
+	if err != nil {
+		return snapshot, err
+	}
+	for rows.Next() {
+		var session string
+		var until time.Time
+		if err := rows.Scan(&session, &until); err != nil {
+			rows.Close()
+			return snapshot, err
+		}
+		snapshot.Revocations[session] = until
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return snapshot, err
+	}
+
+	rows, err = s.db.Query(`SELECT token, name, language, language_confidence, language_source, role, account, languages, skills, max_rooms FROM clients`)
+	if err != nil {
+		return snapshot, err
+	}
+	for rows.Next() {
+		var c ClientRecord
+		var role, source, languages, skills string
+		if err := rows.Scan(&c.Token, &c.Name, &c.Language, &c.LanguageConfidence, &source, &role, &c.Account, &languages, &skills, &c.MaxRooms); err != nil {
+			rows.Close()
+			return snapshot, err
+		}
+		c.Role = Role(role)
+		c.LanguageSource = LanguageSource(source)
+		json.Unmarshal([]byte(languages), &c.Languages)
+		json.Unmarshal([]byte(skills), &c.Skills)
+		snapshot.Clients = append(snapshot.Clients, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return snapshot, err
+	}
+
+	rows, err = s.db.Query(`SELECT id, customer_token, agent_token, status, topic, transferred_from, transfer_note, created_at FROM rooms ORDER BY created_at`)
+	if err != nil {
+		return snapshot, err
+	}
+	for rows.Next() {
+		var r RoomRecord
+		var status string
+		if err := rows.Scan(&r.ID, &r.CustomerToken, &r.AgentToken, &status, &r.Topic, &r.TransferredFrom, &r.TransferNote, &r.CreatedAt); err != nil {
+			rows.Close()
+			return snapshot, err
+		}
+		r.Status = RoomStatus(status)
+		snapshot.Rooms = append(snapshot.Rooms, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return snapshot, err
+	}
+
+	rows, err = s.db.Query(`SELECT m.room_id, m.data FROM messages m JOIN rooms r ON r.id = m.room_id ORDER BY m.seq`)
+	if err != nil {
+		return snapshot, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var roomID, data string
+		if err := rows.Scan(&roomID, &data); err != nil {
+			return snapshot, err
+		}
+		var msg ChatMessage
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			return snapshot, err
+		}
+		snapshot.Messages[roomID] = append(snapshot.Messages[roomID], msg)
+	}
+	return snapshot, rows.Err()
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.db")
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hub, err := NewHub(store, NewLocalBus())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	customer := NewClient("Alice", "pt")
+	hub.AddClient(customer)
+	agent := NewClient("Bob", "en")
+	agent.Languages = []string{"pt", "es"}
+	agent.Skills = []string{"billing"}
+	agent.Role = RoleAgent
+	agent.Account = "bob"
+	hub.AddClient(agent)
+	if err := store.SaveAccount(Account{Username: "bob", Role: RoleAgent, Name: "Bob"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hub.RevokeSession("logged-out", time.Now().Add(time.Hour))
+	room := hub.CreateRoom(customer, "billing")
+	msg := hub.AddMessage(room, ChatMessage{Type: "message", RoomID: room.ID, From: "Alice", SenderID: customer.ID(), Content: "Olá"})
+	if _, err := hub.Acknowledge(room, agent, msg.ID, ReceiptRead); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store.Close()
+
+	store, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer store.Close()
+	restarted, err := NewHub(store, NewLocalBus())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, ok := restarted.GetRoom(room.ID)
+	if !ok {
+		t.Fatal("expected room to survive restart")
+	}
+	if got.Customer.Token != customer.Token || got.Customer.Language != "pt" {
+		t.Errorf("expected customer Alice (pt), got %+v", got.Customer)
+	}
+	if got.Topic != "billing" {
+		t.Errorf("expected topic billing, got %q", got.Topic)
+	}
+	bob, ok := restarted.GetClient(agent.Token)
+	if !ok || !bob.Speaks("es") || !bob.HasSkill("billing") || bob.Account != "bob" || bob.Role != RoleAgent {
+		t.Errorf("expected agent profile to survive restart, got %+v", bob)
+	}
+	if !restarted.IsRevoked("logged-out") {
+		t.Error("expected revocation to survive restart")
+	}
+	accounts, err := store.LoadAccounts()
+	if err != nil || len(accounts) != 1 || accounts[0].Username != "bob" {
+		t.Errorf("expected saved account, got %v (%v)", accounts, err)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Content != "Olá" || got.Messages[0].ID != msg.ID {
+		t.Fatalf("expected 1 restored message, got %v", got.Messages)
+	}
+	if receipt := got.Messages[0].Receipts[agent.ID()]; receipt.ReadAt.IsZero() {
+		t.Errorf("expected read receipt to survive restart, got %+v", got.Messages[0].Receipts)
+	}
+}
+
+func TestStoreDeleteRoomKeepsHistory(t *testing.T) {
+	sqlite, err := NewSQLiteStore(filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sqlite.Close()
+	memory := NewMemoryStore()
+
+	for name, tc := range map[string]struct {
+		store Store
+		kept  func() int
+	}{
+		"memory": {memory, func() int {
+			memory.mu.Lock()
+			defer memory.mu.Unlock()
+			return len(memory.messages["room_1"])
+		}},
+		"sqlite": {sqlite, func() int {
+			var n int
+			sqlite.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE room_id = ?`, "room_1").Scan(&n)
+			return n
+		}},
+	} {
+		tc.store.SaveRoom(RoomRecord{ID: "room_1", CustomerToken: "c1", Status: RoomWaiting})
+		tc.store.AppendMessage("room_1", ChatMessage{ID: "msg_1", RoomID: "room_1", Content: "Olá"})
+		tc.store.DeleteRoom("room_1")
+
+		snapshot, err := tc.store.Load()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if len(snapshot.Rooms) != 0 || len(snapshot.Messages) != 0 {
+			t.Errorf("%s: expected no rooms or messages loaded, got %d and %d", name, len(snapshot.Rooms), len(snapshot.Messages))
+		}
+		if kept := tc.kept(); kept != 1 {
+			t.Errorf("%s: expected the deleted room's message to be kept, got %d", name, kept)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	errMalformedToken = errors.New("malformed token")
+	errBadSignature   = errors.New("invalid token signature")
+	errTokenExpired   = errors.New("token expired")
+)
+
+// Claims are what a signed token asserts. Subject is the client's internal
+// token (the key in Hub.Clients). Session is shared by a login's token and
+// every token refreshed from it, so logging out revokes them together.
+type Claims struct {
+	Subject string `json:"sub"`
+	Role    Role   `json:"role"`
+	Session string `json:"sid"`
+	// Purpose is empty for bearer tokens, purposeTicket for WebSocket
+	// connect tickets (which carry a unique ID so they can be spent once)
+	// and purposeResume for customer resume tokens.
+	Purpose   string `json:"use,omitempty"`
+	ID        string `json:"jti,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+const (
+	purposeTicket = "ws_ticket"
+	purposeResume = "resume"
+)
+
+// tokenHeader is the fixed JWT header; only HS256 is issued or accepted.
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// signToken encodes claims as an HS256 JWT.
+func signToken(secret []byte, claims Claims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + tokenSignature(secret, unsigned), nil
+}
+
+// parseToken checks a token's signature and expiry and returns its claims.
+func parseToken(secret []byte, token string, now time.Time) (Claims, error) {
+	var claims Claims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return claims, errMalformedToken
+	}
+	want := tokenSignature(secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(parts[2]), []byte(want)) {
+		return claims, errBadSignature
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, errMalformedToken
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, errMalformedToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return claims, errTokenExpired
+	}
+	return claims, nil
+}
+
+func tokenSignature(secret []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
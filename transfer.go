@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sort"
+)
+
+var (
+	errNotRoomAgent     = errors.New("you are not the agent in this room")
+	errAgentNotFound    = errors.New("agent not found")
+	errAgentUnavailable = errors.New("agent is not available or at capacity")
+	errTransferToSelf   = errors.New("cannot transfer a room to yourself")
+)
+
+// TransferRoom hands an active room from one agent to another in a single
+// step, so the customer is never left without an agent. With to == nil the
+// room goes back to the queue instead (under topic, if set), and the queue
+// won't give it back to from.
+func (h *Hub) TransferRoom(room *Room, from *Client, to *Client, topic string, note string) error {
+	room.ops.Lock()
+	defer room.ops.Unlock()
+	h.mu.Lock()
+	if room.Agent == nil || room.Agent.Token != from.Token || room.Status != RoomActive {
+		h.mu.Unlock()
+		return errNotRoomAgent
+	}
+
+	if to == nil {
+		if err := h.setStatus(room, RoomWaiting); err != nil {
+			h.mu.Unlock()
+			return err
+		}
+		room.Agent = nil
+		setTransfer(room, from, topic, note)
+		h.saveRoom(room)
+		h.mu.Unlock()
+		slog.Info("room transferred to queue", "room", room.ID, "from", from.Name)
+		h.notifyTransferred(room, nil)
+		h.Assign()
+		return nil
+	}
+
+	if to.Token == from.Token {
+		h.mu.Unlock()
+		return errTransferToSelf
+	}
+	if _, ok := h.available[to.Token]; !ok || h.agentLoad(to.Token) >= to.capacity() {
+		h.mu.Unlock()
+		return errAgentUnavailable
+	}
+	room.Agent = to
+	setTransfer(room, from, topic, note)
+	h.saveRoom(room)
+	h.mu.Unlock()
+	slog.Info("room transferred", "room", room.ID, "from", from.Name, "to", to.Name)
+
+	if err := h.Deliver(context.Background(), to, h.assignedEvent(room)); err != nil {
+		slog.Error("failed to notify agent", "agent", to.Name, "error", err)
+	}
+	h.notifyTransferred(room, to)
+	// from has a free slot now.
+	h.Assign()
+	return nil
+}
+
+// setTransfer records a transfer from from on room, once it's known to
+// go ahead. Callers must hold h.mu.
+func setTransfer(room *Room, from *Client, topic string, note string) {
+	room.TransferredFrom = from.Token
+	room.TransferNote = note
+	if topic != "" {
+		room.Topic = topic
+	}
+}
+
+// notifyTransferred tells the customer their chat moved to agent, or back
+// to the queue when agent is nil.
+func (h *Hub) notifyTransferred(room *Room, agent *Client) {
+	if room.Customer == nil || !h.IsOnline(room.Customer) {
+		return
+	}
+	event := TransferredEvent{Type: "transferred", RoomID: room.ID}
+	if agent != nil {
+		event.AgentName = agent.Name
+	}
+	data, _ := json.Marshal(event)
+	h.Deliver(context.Background(), room.Customer, data)
+}
+
+// AgentByID finds a client by its public ID.
+func (h *Hub) AgentByID(id string) (*Client, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.clientByID(id)
+}
+
+// clientByID looks a client up by its public ID. Callers must hold h.mu.
+func (h *Hub) clientByID(id string) (*Client, bool) {
+	for _, client := range h.Clients {
+		if client.ID() == id {
+			return client, true
+		}
+	}
+	return nil, false
+}
+
+// Agents lists available agents, least loaded first.
+func (h *Hub) Agents() []AgentInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var agents []AgentInfo
+	for token := range h.available {
+		agent, ok := h.Clients[token]
+		if !ok {
+			continue
+		}
+		agents = append(agents, AgentInfo{
+			ID:        agent.ID(),
+			Name:      agent.Name,
+			Language:  agent.Language,
+			Languages: agent.Languages,
+			Skills:    agent.Skills,
+			Rooms:     h.agentLoad(token),
+			MaxRooms:  agent.capacity(),
+		})
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		if agents[i].Rooms != agents[j].Rooms {
+			return agents[i].Rooms < agents[j].Rooms
+		}
+		return agents[i].Name < agents[j].Name
+	})
+	return agents
+}
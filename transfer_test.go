@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// assignedTo sets up a room handled by agent.
+func assignedTo(t *testing.T, hub *Hub, agent *Client) *Room {
+	t.Helper()
+	hub.AddClient(agent)
+	hub.SetAvailable(agent, true)
+	room := hub.CreateRoom(NewClient("Alice", "pt"), "")
+	if room.Agent != agent {
+		t.Fatalf("expected room to be assigned to %s", agent.Name)
+	}
+	return room
+}
+
+func TestTransferRoomToAgent(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	dave := NewClient("Dave", "es")
+	hub.AddClient(dave)
+	hub.SetAvailable(dave, true)
+
+	if err := hub.TransferRoom(room, bob, dave, "", "wants a refund"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if room.Agent != dave || room.Status != RoomActive {
+		t.Errorf("expected active room with Dave, got %v / %s", room.Agent.Name, room.Status)
+	}
+	if room.TransferNote != "wants a refund" || room.TransferredFrom != bob.Token {
+		t.Errorf("expected transfer note from Bob, got %q from %q", room.TransferNote, room.TransferredFrom)
+	}
+}
+
+func TestTransferRoomToQueueSkipsPreviousAgent(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+
+	if err := hub.TransferRoom(room, bob, nil, "billing", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if room.Status != RoomWaiting || room.Topic != "billing" {
+		t.Fatalf("expected room back in the queue under billing, got %s / %q", room.Status, room.Topic)
+	}
+
+	dave := NewClient("Dave", "en")
+	hub.AddClient(dave)
+	hub.SetAvailable(dave, true)
+	if room.Agent != dave {
+		t.Errorf("expected Dave to get the transferred room, got %v", room.Agent)
+	}
+}
+
+func TestTransferRequiresCurrentAgent(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	dave := NewClient("Dave", "en")
+	hub.AddClient(dave)
+
+	if err := hub.TransferRoom(room, dave, nil, "", ""); !errors.Is(err, errNotRoomAgent) {
+		t.Errorf("expected errNotRoomAgent, got %v", err)
+	}
+}
+
+func TestTransferToUnavailableAgent(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	dave := NewClient("Dave", "en")
+	hub.AddClient(dave)
+
+	if err := hub.TransferRoom(room, bob, dave, "technical", "secret note"); !errors.Is(err, errAgentUnavailable) {
+		t.Errorf("expected errAgentUnavailable, got %v", err)
+	}
+	if err := hub.TransferRoom(room, bob, bob, "technical", "secret note"); !errors.Is(err, errTransferToSelf) {
+		t.Errorf("expected errTransferToSelf, got %v", err)
+	}
+	if room.Agent != bob || room.TransferredFrom != "" || room.TransferNote != "" || room.Topic != "" {
+		t.Errorf("expected refused transfers to leave the room alone, got note %q and topic %q", room.TransferNote, room.Topic)
+	}
+}
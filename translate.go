@@ -1,92 +1,140 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"sync"
-	"time"
+	"context"
+	"sync/atomic"
 )
 
-type cacheEntry struct {
-	text      string
-	createdAt time.Time
+type Translator struct {
+	provider TranslationProvider
+	cache    *TranslationCache
+	inflight flightGroup
+
+	// slots bounds concurrent backend calls; nil leaves them unbounded.
+	slots   chan struct{}
+	running atomic.Int64
+	waiting atomic.Int64
 }
 
-type Translator struct {
-	client   *http.Client
-	url      string
-	model    string
-	cacheTTL time.Duration
-	cache    map[string]cacheEntry
-	cacheMu  sync.RWMutex
+// BackendStats is how busy the translation backend is. Utilisation is
+// InFlight over MaxConcurrent, or 0 when calls aren't bounded.
+type BackendStats struct {
+	InFlight      int64   `json:"in_flight"`
+	Waiting       int64   `json:"waiting"`
+	MaxConcurrent int     `json:"max_concurrent"`
+	Utilisation   float64 `json:"utilisation"`
 }
 
-func NewTranslator(url string, model string, cacheTTL time.Duration) *Translator {
+func NewTranslator(provider TranslationProvider, cache *TranslationCache) *Translator {
 	return &Translator{
-		url:      url,
-		model:    model,
-		cacheTTL: cacheTTL,
-		client:   &http.Client{Timeout: time.Second * 30},
-		cache:    make(map[string]cacheEntry),
+		provider: provider,
+		cache:    cache,
 	}
 }
 
-func (t *Translator) generate(prompt string) (string, error) {
-	reqBody := map[string]any{
-		"model":  t.model,
-		"prompt": prompt,
-		"stream": false,
-	}
-	body, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", err
+// SetMaxConcurrent caps how many calls run against the backend at once,
+// across all rooms; the rest wait for a slot. Cache hits don't take one.
+// Call it before the translator is used.
+func (t *Translator) SetMaxConcurrent(n int) {
+	if n > 0 {
+		t.slots = make(chan struct{}, n)
 	}
+}
 
-	resp, err := t.client.Post(t.url+"/api/generate", "application/json", bytes.NewReader(body))
-	if err != nil {
-		return "", err
+// acquire waits for a backend slot and returns the func that frees it.
+func (t *Translator) acquire() (release func()) {
+	if t.slots != nil {
+		t.waiting.Add(1)
+		t.slots <- struct{}{}
+		t.waiting.Add(-1)
 	}
-
-	defer resp.Body.Close()
-
-	var result struct {
-		Response string `json:"response"`
+	t.running.Add(1)
+	return func() {
+		t.running.Add(-1)
+		if t.slots != nil {
+			<-t.slots
+		}
 	}
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+func (t *Translator) BackendStats() BackendStats {
+	stats := BackendStats{
+		InFlight:      t.running.Load(),
+		Waiting:       t.waiting.Load(),
+		MaxConcurrent: cap(t.slots),
+	}
+	if stats.MaxConcurrent > 0 {
+		stats.Utilisation = float64(stats.InFlight) / float64(stats.MaxConcurrent)
 	}
+	return stats
+}
 
-	return result.Response, nil
+func (t *Translator) DetectLanguage(ctx context.Context, text string) (string, error) {
+	defer t.acquire()()
+	return t.provider.DetectLanguage(ctx, text)
 }
 
-func (t *Translator) DetectLanguage(text string) (string, error) {
-	prompt := fmt.Sprintf("What language is this text? Reply with ONLY the ISO language code (e.g. en, pt, es, fr): %s", text)
-	return t.generate(prompt)
+func (t *Translator) Translate(ctx context.Context, text string, fromLanguage string, toLanguage string) (string, error) {
+	return t.TranslateStream(ctx, text, fromLanguage, toLanguage, nil)
 }
 
-func (t *Translator) Translate(text string, fromLanguage string, toLanguage string) (string, error) {
-	prompt := fmt.Sprintf("Translate the following text from %s to %s. Return ONLY the translation, nothing else: %s", fromLanguage, toLanguage, text)
+// TranslateStream is Translate with incremental output through onDelta,
+// which may be nil. Concurrent calls for the same text and language pair
+// share one backend call; only the caller that made it sees the real
+// stream; everyone else, and cache hits, get the result as a single delta.
+func (t *Translator) TranslateStream(ctx context.Context, text string, fromLanguage string, toLanguage string, onDelta func(delta string)) (string, error) {
 	key := fromLanguage + ":" + toLanguage + ":" + text
-	t.cacheMu.RLock()
-	translated, ok := t.cache[key]
-	t.cacheMu.RUnlock()
-	expired := time.Since(translated.createdAt) > t.cacheTTL
-	if !ok || expired {
-		translated, err := t.generate(prompt)
-		if err != nil {
-			return translated, err
+	if cached, ok := t.cache.Get(key); ok {
+		if onDelta != nil {
+			onDelta(cached)
+		}
+		return cached, nil
+	}
+
+	translated, err, shared := t.inflight.Do(key, func() (string, error) {
+		// Another caller may have filled the cache between our miss and
+		// becoming the leader.
+		if cached, ok := t.cache.Get(key); ok {
+			if onDelta != nil {
+				onDelta(cached)
+			}
+			return cached, nil
 		}
-		t.cacheMu.Lock()
-		t.cache[key] = cacheEntry{
-			text:      translated,
-			createdAt: time.Now(),
+
+		// Other callers are waiting on this result, so our cancellation
+		// shouldn't abort it for them.
+		callCtx := context.WithoutCancel(ctx)
+		defer t.acquire()()
+
+		var translated string
+		var err error
+		if sp, ok := t.provider.(StreamingProvider); ok && onDelta != nil {
+			translated, err = sp.TranslateStream(callCtx, text, fromLanguage, toLanguage, onDelta)
+		} else {
+			translated, err = t.provider.Translate(callCtx, text, fromLanguage, toLanguage)
+			if err == nil && onDelta != nil {
+				onDelta(translated)
+			}
 		}
-		t.cacheMu.Unlock()
+		if err != nil {
+			return "", err
+		}
+		t.cache.Set(key, translated)
 		return translated, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if shared && onDelta != nil {
+		onDelta(translated)
 	}
+	return translated, nil
+}
+
+func (t *Translator) CacheStats() CacheStats {
+	return t.cache.Stats()
+}
 
-	return translated.text, nil
+func (t *Translator) Health(ctx context.Context) error {
+	return t.provider.Health(ctx)
 }
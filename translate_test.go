@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTranslateUsesProvider(t *testing.T) {
+	translator := NewTranslator(NewFakeProvider(), NewTranslationCache(CacheOptions{TTL: time.Minute}))
+
+	got, err := translator.Translate(context.Background(), "hola", "es", "en")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "[en] hola" {
+		t.Errorf("expected [en] hola, got %s", got)
+	}
+}
+
+func TestTranslateCachesResult(t *testing.T) {
+	provider := NewFakeProvider()
+	translator := NewTranslator(provider, NewTranslationCache(CacheOptions{TTL: time.Minute}))
+
+	translator.Translate(context.Background(), "hola", "es", "en")
+	translator.Translate(context.Background(), "hola", "es", "en")
+
+	if provider.Calls() != 1 {
+		t.Errorf("expected 1 provider call, got %d", provider.Calls())
+	}
+}
+
+func TestTranslateProviderError(t *testing.T) {
+	provider := NewFakeProvider()
+	provider.Err = errors.New("backend down")
+	translator := NewTranslator(provider, NewTranslationCache(CacheOptions{TTL: time.Minute}))
+
+	if _, err := translator.Translate(context.Background(), "hola", "es", "en"); err == nil {
+		t.Fatal("expected error from provider")
+	}
+}
+
+func TestTranslateStreamFallsBackToSingleDelta(t *testing.T) {
+	translator := NewTranslator(NewFakeProvider(), NewTranslationCache(CacheOptions{TTL: time.Minute}))
+
+	var deltas []string
+	got, err := translator.TranslateStream(context.Background(), "hola", "es", "en", func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deltas) != 1 || deltas[0] != got {
+		t.Errorf("expected a single delta equal to %q, got %v", got, deltas)
+	}
+}
+
+func TestTranslateCoalescesConcurrentCalls(t *testing.T) {
+	provider := NewFakeProvider()
+	provider.Delay = 50 * time.Millisecond
+	translator := NewTranslator(provider, NewTranslationCache(CacheOptions{TTL: time.Minute}))
+
+	var wg sync.WaitGroup
+	results := make([]string, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = translator.Translate(context.Background(), "hola", "es", "en")
+		}()
+	}
+	wg.Wait()
+
+	if provider.Calls() != 1 {
+		t.Errorf("expected 1 provider call, got %d", provider.Calls())
+	}
+	for _, got := range results {
+		if got != "[en] hola" {
+			t.Errorf("expected [en] hola, got %q", got)
+		}
+	}
+}
+
+func TestFlightGroupReleasesWaitersOnPanic(t *testing.T) {
+	var group flightGroup
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		defer func() { recover() }()
+		group.Do("key", func() (string, error) {
+			close(started)
+			<-release
+			panic("backend blew up")
+		})
+	}()
+	<-started
+
+	done := make(chan error, 1)
+	go func() {
+		_, err, _ := group.Do("key", func() (string, error) { return "fresh", nil })
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errFlightPanicked) {
+			t.Errorf("expected errFlightPanicked, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the waiter to be released after the panic")
+	}
+	if val, err, shared := group.Do("key", func() (string, error) { return "fresh", nil }); val != "fresh" || err != nil || shared {
+		t.Errorf("expected a new call after the panic, got %q, %v, %v", val, err, shared)
+	}
+}
@@ -10,177 +10,502 @@ import (
 	"github.com/coder/websocket"
 )
 
-func prepareMessage(translator *Translator, room *Room, sender *Client, recipient *Client, content string) ChatMessage {
-	msg := ChatMessage{
-		Type:    "message",
-		RoomID:  room.ID,
-		From:    sender.Name,
-		Content: content,
+// prepareMessage builds the message the recipient should see. If onDelta
+// is non-nil the translation is streamed through it as it's produced.
+func prepareMessage(ctx context.Context, translator *Translator, room *Room, sender party, recipient party, content string, onDelta func(delta string)) ChatMessage {
+	target := translationTarget(sender, recipient)
+	if target == "" {
+		return messageView(room, sender, recipient, content, "")
 	}
 
-	// Detect customer language if unknown
-	if sender == room.Customer && sender.Language == "" {
-		lang, err := translator.DetectLanguage(content)
-		if err != nil {
-			slog.Error("failed to detect language", "error", err)
-			return msg
-		}
-		sender.Language = strings.TrimSpace(lang)
-		slog.Info("detected language", "client", sender.Name, "language", sender.Language)
+	var translated string
+	var err error
+	if onDelta != nil {
+		translated, err = translator.TranslateStream(ctx, content, sender.language, target, onDelta)
+	} else {
+		translated, err = translator.Translate(ctx, content, sender.language, target)
 	}
-
-	// Skip if either language is unknown or they're the same
-	if sender.Language == "" || recipient.Language == "" || sender.Language == recipient.Language {
-		return msg
+	if err != nil {
+		slog.Error("translation failed", "error", err)
+		translated = ""
 	}
+	return messageView(room, sender, recipient, content, translated)
+}
 
-	// Translate
-	translated, err := translator.Translate(content, sender.Language, recipient.Language)
+// detectLanguage keeps the customer's language in step with what they
+// write: it fills it in when unknown and lets the customer switch language
+// mid-conversation (see Hub.ObserveLanguage). Messages too short to tell
+// languages apart don't change a known language, and nothing changes a
+// declared one. It returns the language to translate content from.
+func detectLanguage(ctx context.Context, hub *Hub, translator *Translator, room *Room, sender party, content string) string {
+	if sender.client != room.Customer || sender.source == LanguageDeclared ||
+		(sender.language != "" && letterCount(content) < minRedetectLetters) {
+		return sender.language
+	}
+	detection, err := translator.Detect(ctx, content)
 	if err != nil {
-		slog.Error("translation failed", "error", err)
-		return msg
+		slog.Error("failed to detect language", "error", err)
+		return sender.language
 	}
-	translated = strings.TrimSpace(translated)
+	if !hub.ObserveLanguage(sender.client, detection) {
+		return sender.language
+	}
+	slog.Info("detected language", "client", sender.name, "language", detection.Language,
+		"confidence", detection.Confidence, "source", detection.Source)
+	return detection.Language
+}
+
+// translationTarget is the language recipient needs sender's words in, or
+// "" when either language is unknown or the two already share one.
+func translationTarget(sender party, recipient party) string {
+	if sender.language == "" || recipient.language == "" || !needsTranslation(sender, recipient) {
+		return ""
+	}
+	return recipient.language
+}
 
-	// Customer sees translated only, agent sees both
-	if recipient == room.Customer {
+// messageView is what recipient sees of a message: the customer gets the
+// translation only, staff get the original with the translation alongside.
+// An empty translated means none was needed (or it failed).
+func messageView(room *Room, sender party, recipient party, content string, translated string) ChatMessage {
+	msg := ChatMessage{
+		Type:     "message",
+		RoomID:   room.ID,
+		From:     sender.name,
+		SenderID: sender.client.ID(),
+		Content:  content,
+	}
+	translated = strings.TrimSpace(translated)
+	if translated == "" {
+		return msg
+	}
+	if recipient.client == room.Customer {
 		msg.Content = translated
 	} else {
 		msg.TranslatedContent = translated
 	}
-
 	return msg
 }
 
-func handleWebSocket(hub *Hub, translator *Translator, limiter *RateLimiter) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.URL.Query().Get("token")
-		if token == "" {
-			http.Error(w, "token required", http.StatusUnauthorized)
-			return
+// needsTranslation is false when either side natively speaks the other's
+// language, e.g. a Portuguese customer routed to an agent who lists "pt"
+// among their languages.
+func needsTranslation(sender party, recipient party) bool {
+	return !recipient.speaks(sender.language) && !sender.speaks(recipient.language)
+}
+
+// streamDeltas returns a callback that forwards each translation chunk to
+// the recipient as a message_delta frame tagged with id.
+func streamDeltas(ctx context.Context, hub *Hub, recipient party, room *Room, sender party, id string) func(delta string) {
+	return func(delta string) {
+		data, _ := json.Marshal(MessageDelta{
+			Type:   "message_delta",
+			ID:     id,
+			RoomID: room.ID,
+			From:   sender.name,
+			Delta:  delta,
+		})
+		if err := hub.Deliver(ctx, recipient.client, data); err != nil {
+			slog.Error("failed to send delta", "recipient", recipient.name, "error", err)
 		}
+	}
+}
 
+func handleWebSocket(hub *Hub, pipeline *Pipeline, limiter *RateLimiter, sockets *SocketAuth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		roomID := r.URL.Query().Get("room_id")
 		if roomID == "" {
 			http.Error(w, "room_id required", http.StatusBadRequest)
 			return
 		}
 
-		client, ok := hub.GetClient(token)
+		conn, client, claims, ok := sockets.Accept(w, r, RoleCustomer)
 		if !ok {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
 			return
 		}
+		defer conn.Close(websocket.StatusNormalClosure, "")
 
+		// The client may only be known after the auth frame, so room
+		// checks close the socket rather than returning an HTTP error.
 		room, ok := hub.GetRoom(roomID)
 		if !ok {
-			http.Error(w, "room not found", http.StatusNotFound)
+			conn.Close(websocket.StatusPolicyViolation, "room not found")
 			return
 		}
-
-		// Verify this client belongs to this room
-		if (room.Customer == nil || room.Customer.Token != token) &&
-			(room.Agent == nil || room.Agent.Token != token) {
-			http.Error(w, "you are not in this room", http.StatusForbidden)
+		if agent := hub.RoomAgent(room); (room.Customer == nil || room.Customer.Token != client.Token) &&
+			(agent == nil || agent.Token != client.Token) {
+			conn.Close(websocket.StatusPolicyViolation, "you are not in this room")
 			return
 		}
 
-		conn, err := websocket.Accept(w, r, nil)
-		if err != nil {
-			slog.Error("websocket accept error", "error", err)
+		hub.Connect(client, conn, claims.Session, r.URL.Query().Get("stream") == "true")
+		defer hub.Disconnect(client, conn)
+		slog.Info("websocket connected", "client", client.Name, "room", room.ID)
+
+		ctx := context.Background()
+
+		// Send message history to the agent on connect. A customer coming
+		// back after a reload or dropped connection asks for it with
+		// last_id: empty for the whole transcript, or the last message
+		// they saw.
+		if client == hub.RoomAgent(room) {
+			pipeline.History(room, client, "")
+		} else if query := r.URL.Query(); query.Has("last_id") {
+			pipeline.History(room, client, query.Get("last_id"))
+		}
+
+		for {
+			_, data, err := conn.Read(ctx)
+			if err != nil {
+				slog.Info("client disconnected", "client", client.Name, "error", err)
+				break
+			}
+
+			frame, err := decodeFrame(conn.Subprotocol(), data)
+			if err != nil {
+				rejectFrame(ctx, hub, client, frame, err)
+				continue
+			}
+
+			switch frame.Type {
+			case "typing_start", "typing_stop":
+				relayTyping(ctx, hub, room, client, frame.Type)
+			case "delivered", "read":
+				acknowledge(ctx, hub, room, client, frame.ID, ReceiptStatus(frame.Type), frame.Ref)
+			case "set_language":
+				changeLanguage(ctx, hub, pipeline, room, client, frame.Language, frame.Ref)
+			case "message":
+				if !relayMessage(ctx, hub, pipeline, limiter, room, client, frame.Content, frame.Ref) {
+					return
+				}
+			default:
+				sendError(ctx, hub, client, ErrorResponse{Code: CodeInvalidPayload, RoomID: room.ID, Ref: frame.Ref, Message: "unknown frame type: " + frame.Type})
+			}
+		}
+	}
+}
+
+// sendHistory replays history, a room's transcript, to recipient,
+// translated into their language. Each message is translated from the language it
+// was recorded in, or its sender's current one (see Hub.MessageSender).
+// With after set, only messages after that ID are sent, minus the
+// recipient's own, which they already have; an ID that isn't in the
+// transcript replays all of it. The customer never sees whispers, and
+// only sees receipts on their own messages.
+func sendHistory(ctx context.Context, hub *Hub, translator *Translator, room *Room, recipient party, history []ChatMessage, after string) {
+	messages := history
+	if after != "" {
+		for i, msg := range messages {
+			if msg.ID == after {
+				messages = messages[i+1:]
+				break
+			}
+		}
+	}
+	replay(ctx, hub, translator, room, recipient, messages, len(messages) < len(history))
+}
+
+// sendRecent re-sends room's last n messages to recipient, translated into
+// their language, except the ones they sent.
+func sendRecent(ctx context.Context, hub *Hub, translator *Translator, room *Room, recipient party, n int) {
+	history := hub.History(room)
+	replay(ctx, hub, translator, room, recipient, history[max(0, len(history)-n):], true)
+}
+
+// replay delivers messages to recipient as sendHistory describes, skipping
+// their own if skipOwn is set.
+func replay(ctx context.Context, hub *Hub, translator *Translator, room *Room, recipient party, messages []ChatMessage, skipOwn bool) {
+	client := recipient.client
+	for _, msg := range messages {
+		if skipOwn && msg.SenderID == client.ID() {
+			continue
+		}
+		if msg.Type == "whisper" && client == room.Customer {
+			continue
+		}
+		chatMsg := prepareMessage(ctx, translator, room, hub.MessageSender(room, msg), recipient, msg.Content, nil)
+		chatMsg.Type = msg.Type
+		chatMsg.ID = msg.ID
+		chatMsg.Seq = msg.Seq
+		chatMsg.SentAt = msg.SentAt
+		chatMsg.SenderID = msg.SenderID
+		if client != room.Customer || msg.SenderID == client.ID() {
+			chatMsg.Receipts = msg.Receipts
+		}
+		data, _ := json.Marshal(chatMsg)
+		if err := hub.Deliver(ctx, client, data); err != nil {
+			slog.Error("failed to deliver history", "client", recipient.name, "error", err)
+		}
+	}
+}
+
+// changeLanguage switches client to a language they chose, confirms it
+// with language_changed and queues room's recent messages to be sent again
+// in the new language.
+func changeLanguage(ctx context.Context, hub *Hub, pipeline *Pipeline, room *Room, client *Client, language string, ref string) {
+	// decodeFrame has already checked the tag.
+	language, _ = canonicalLanguage(language)
+	hub.DeclareLanguage(client, language)
+	slog.Info("language declared", "client", client.Name, "room", room.ID, "language", language)
+
+	changed, _ := json.Marshal(LanguageChangedEvent{
+		Type:     "language_changed",
+		RoomID:   room.ID,
+		Ref:      ref,
+		Language: language,
+		Source:   LanguageDeclared,
+	})
+	hub.Deliver(ctx, client, changed)
+	pipeline.Retranslate(room, client)
+}
+
+// sendError tells client something went wrong, usually with a frame they
+// sent.
+func sendError(ctx context.Context, hub *Hub, client *Client, e ErrorResponse) {
+	e.Type = "error"
+	data, _ := json.Marshal(e)
+	hub.Deliver(ctx, client, data)
+}
+
+// relayMessage records a message from client and queues it on pipeline to
+// be translated and delivered to everyone else in room (see
+// deliverMessage). The client gets a "sent" event echoing ref straight
+// away. A supervisor's mode decides who hears them: monitors can't send,
+// whispers only reach staff. It returns false once the room is closed.
+func relayMessage(ctx context.Context, hub *Hub, pipeline *Pipeline, limiter *RateLimiter, room *Room, client *Client, content string, ref string) bool {
+	slog.Info("message received", "client", client.Name, "room", room.ID, "content", content)
+
+	msgType := "message"
+	if mode, ok := hub.ParticipantMode(room, client); ok {
+		switch mode {
+		case ModeMonitor:
+			sendError(ctx, hub, client, ErrorResponse{Code: CodeForbidden, RoomID: room.ID, Ref: ref,
+				Message: "monitoring is read-only; switch to whisper or barge to send"})
+			return true
+		case ModeWhisper:
+			msgType = "whisper"
+		}
+	}
+
+	// Rate limit check
+	if !limiter.Allow(client.Token) {
+		sendError(ctx, hub, client, ErrorResponse{Code: CodeRateLimited, RoomID: room.ID, Ref: ref, Message: "rate limit exceeded"})
+		return true
+	}
+
+	// Record in history
+	sender := hub.Party(client)
+	recorded := hub.AddMessage(room, ChatMessage{
+		Type:     msgType,
+		RoomID:   room.ID,
+		From:     sender.name,
+		SenderID: client.ID(),
+		Content:  content,
+		Language: sender.language,
+	})
+	sent, _ := json.Marshal(SentEvent{
+		Type:   "sent",
+		RoomID: room.ID,
+		Ref:    ref,
+		ID:     recorded.ID,
+		Seq:    recorded.Seq,
+		SentAt: recorded.SentAt,
+	})
+	hub.Deliver(ctx, client, sent)
+
+	// Reject messages to a closed room
+	status := hub.RoomStatus(room)
+	if status == RoomClosed {
+		sendError(ctx, hub, client, ErrorResponse{Code: CodeRoomClosed, RoomID: room.ID, Ref: ref, Message: "room is closed"})
+		return false
+	}
+
+	// Customer sends a message while room is closing — cancel the timer, reopen the room
+	if status == RoomClosing && room.Customer != nil && room.Customer.Token == client.Token {
+		if err := hub.ReopenRoom(room); err == nil {
+			slog.Info("room reopened by customer", "room", room.ID)
+		}
+	}
+
+	// Recipients who aren't connected are skipped (message is already in
+	// history, and in the replay they get on connecting).
+	recipients := hub.Recipients(room, client, msgType == "whisper")
+	err := pipeline.Submit(room, func(ctx context.Context) {
+		deliverMessage(ctx, hub, pipeline.translator, room, sender, recipients, recorded, ref)
+	})
+	if err != nil {
+		sendError(ctx, hub, client, ErrorResponse{Code: CodeRateLimited, RoomID: room.ID, Ref: ref,
+			Message: "room is busy; the message is saved but wasn't delivered"})
+	}
+	return true
+}
+
+// deliverMessage translates a recorded message from sender for
+// recipients, the room members who were online when it was sent, and
+// delivers it. If translation fails for some of them, sender gets a
+// translation_failed error echoing ref.
+func deliverMessage(ctx context.Context, hub *Hub, translator *Translator, room *Room, sender party, recipients []party, recorded ChatMessage, ref string) {
+	if len(recipients) == 0 {
+		slog.Info("message recorded", "room", room.ID, "reason", "recipient not connected")
+		return
+	}
+	sender.language = detectLanguage(ctx, hub, translator, room, sender, recorded.Content)
+	if failed := fanOut(ctx, hub, translator, room, sender, recipients, recorded); len(failed) > 0 {
+		sendError(ctx, hub, sender.client, ErrorResponse{Code: CodeTranslationFailed, RoomID: room.ID, Ref: ref,
+			Message: "couldn't translate into " + strings.Join(failed, ", ") + "; recipients got the original"})
+	}
+}
+
+// handleAgentWebSocket is the agent's single socket for all of their
+// rooms. Connecting makes the agent available; the server pushes an
+// "assigned" event whenever the queue hands them a room, and every frame
+// in either direction carries the room_id it belongs to.
+func handleAgentWebSocket(hub *Hub, pipeline *Pipeline, limiter *RateLimiter, sockets *SocketAuth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, agent, claims, ok := sockets.Accept(w, r, RoleAgent)
+		if !ok {
 			return
 		}
 		defer conn.Close(websocket.StatusNormalClosure, "")
 
-		client.Connection = conn
-		defer func() { client.Connection = nil }()
-		slog.Info("websocket connected", "client", client.Name, "room", room.ID)
+		hub.Connect(agent, conn, claims.Session, r.URL.Query().Get("stream") == "true")
+		defer func() {
+			// A newer socket for the same agent keeps their availability.
+			if hub.Disconnect(agent, conn) {
+				hub.SetAvailable(agent, false)
+			}
+		}()
+		slog.Info("agent connected", "agent", agent.Name)
 
 		ctx := context.Background()
 
-		// Find the recipient
-		var recipient *Client
-		if room.Customer.Token == client.Token {
-			recipient = room.Agent
-		} else {
-			recipient = room.Customer
-		}
-
-		// Send message history to the agent on connect
-		if client == room.Agent {
-			for _, msg := range room.Messages {
-				chatMsg := prepareMessage(translator, room, room.Customer, client, msg.Content)
-				data, _ := json.Marshal(chatMsg)
-				if err := conn.Write(ctx, websocket.MessageText, data); err != nil {
-					slog.Error("failed to deliver history", "client", client.Name, "error", err)
-				}
-			}
+		// Re-announce rooms from before a reconnect so the dashboard can
+		// rebuild its conversation list.
+		for _, room := range hub.AgentRooms(agent.Token) {
+			hub.Deliver(ctx, agent, hub.assignedEvent(room))
 		}
+		hub.SetAvailable(agent, true)
 
 		for {
 			_, data, err := conn.Read(ctx)
 			if err != nil {
-				slog.Info("client disconnected", "client", client.Name, "error", err)
-				break
+				slog.Info("agent disconnected", "agent", agent.Name, "error", err)
+				return
 			}
 
-			var msg struct {
-				Content string `json:"content"`
+			frame, err := decodeFrame(conn.Subprotocol(), data)
+			if err != nil {
+				rejectFrame(ctx, hub, agent, frame, err)
+				continue
 			}
-			if err := json.Unmarshal(data, &msg); err != nil {
-				slog.Warn("invalid json", "client", client.Name, "error", err)
+
+			room, ok := hub.GetRoom(frame.RoomID)
+			if !ok || !hub.IsMember(room, agent) {
+				sendError(ctx, hub, agent, ErrorResponse{Code: CodeForbidden, RoomID: frame.RoomID, Ref: frame.Ref, Message: "you are not in this room"})
 				continue
 			}
 
-			slog.Info("message received", "client", client.Name, "content", msg.Content)
+			switch frame.Type {
+			case "history":
+				pipeline.History(room, agent, "")
+			case "typing_start", "typing_stop":
+				relayTyping(ctx, hub, room, agent, frame.Type)
+			case "delivered", "read":
+				acknowledge(ctx, hub, room, agent, frame.ID, ReceiptStatus(frame.Type), frame.Ref)
+			case "set_language":
+				changeLanguage(ctx, hub, pipeline, room, agent, frame.Language, frame.Ref)
+			case "message":
+				relayMessage(ctx, hub, pipeline, limiter, room, agent, frame.Content, frame.Ref)
+			default:
+				sendError(ctx, hub, agent, ErrorResponse{Code: CodeInvalidPayload, RoomID: room.ID, Ref: frame.Ref, Message: "unknown frame type: " + frame.Type})
+			}
+		}
+	}
+}
 
-			// Rate limit check
-			if !limiter.Allow(client.Token) {
-				errMsg, _ := json.Marshal(ErrorResponse{
-					Type:    "error",
-					Message: "rate limit exceeded",
-				})
-				conn.Write(ctx, websocket.MessageText, errMsg)
-				continue
+// handleSupervisorWebSocket lets a supervisor watch any number of rooms.
+// They "watch" a room in monitor, whisper or barge mode (sending "watch"
+// again switches modes), get its history on joining, and then see every
+// message in it. Whispers reach the agent only; barge-in messages are
+// translated for the customer like an agent's.
+func handleSupervisorWebSocket(hub *Hub, pipeline *Pipeline, limiter *RateLimiter, sockets *SocketAuth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, supervisor, claims, ok := sockets.Accept(w, r, RoleSupervisor)
+		if !ok {
+			return
+		}
+		defer conn.Close(websocket.StatusNormalClosure, "")
+
+		hub.Connect(supervisor, conn, claims.Session, r.URL.Query().Get("stream") == "true")
+		defer func() {
+			// A newer socket for the same supervisor keeps their rooms.
+			if hub.Disconnect(supervisor, conn) {
+				hub.RemoveFromAllRooms(supervisor)
 			}
+		}()
+		slog.Info("supervisor connected", "supervisor", supervisor.Name)
 
-			// Record in history
-			room.Messages = append(room.Messages, ChatMessage{
-				Type:    "message",
-				RoomID:  room.ID,
-				From:    client.Name,
-				Content: msg.Content,
-			})
-
-			// Reject messages to a closed room
-			if room.Status == RoomClosed {
-				errMsg, _ := json.Marshal(ErrorResponse{
-					Type:    "error",
-					Message: "room is closed",
-				})
-				conn.Write(ctx, websocket.MessageText, errMsg)
-				break
+		ctx := context.Background()
+		for {
+			_, data, err := conn.Read(ctx)
+			if err != nil {
+				slog.Info("supervisor disconnected", "supervisor", supervisor.Name, "error", err)
+				return
 			}
 
-			// Customer sends a message while room is closing — cancel the timer, reopen the room
-			if room.Status == RoomClosing && room.Customer != nil && room.Customer.Token == client.Token {
-				if room.CloseTimer != nil {
-					room.CloseTimer.Stop()
-					room.CloseTimer = nil
-				}
-				room.Status = RoomWaiting
-				slog.Info("room reopened by customer", "room", room.ID)
+			frame, err := decodeFrame(conn.Subprotocol(), data)
+			if err != nil {
+				rejectFrame(ctx, hub, supervisor, frame, err)
+				continue
 			}
 
-			// If recipient isn't connected, skip live delivery (message is already in history)
-			if recipient == nil || recipient.Connection == nil {
-				slog.Info("message recorded", "room", room.ID, "reason", "recipient not connected")
+			room, ok := hub.GetRoom(frame.RoomID)
+			if !ok {
+				sendError(ctx, hub, supervisor, ErrorResponse{Code: CodeNotFound, RoomID: frame.RoomID, Ref: frame.Ref, Message: "room not found"})
 				continue
 			}
-			chatMsg := prepareMessage(translator, room, client, recipient, msg.Content)
-			data, _ = json.Marshal(chatMsg)
-			if err := recipient.Connection.Write(ctx, websocket.MessageText, data); err != nil {
-				slog.Error("failed to send message", "recipient", recipient.Name, "error", err)
+
+			switch frame.Type {
+			case "watch":
+				if frame.Mode == "" {
+					frame.Mode = ModeMonitor
+				}
+				if !validMode(frame.Mode) {
+					sendError(ctx, hub, supervisor, ErrorResponse{Code: CodeInvalidPayload, RoomID: room.ID, Ref: frame.Ref, Message: "mode must be monitor, whisper or barge"})
+					continue
+				}
+				joined, err := hub.Watch(room, supervisor, frame.Mode)
+				if err != nil {
+					sendError(ctx, hub, supervisor, ErrorResponse{Code: CodeRoomClosed, RoomID: room.ID, Ref: frame.Ref, Message: err.Error()})
+					continue
+				}
+				ack, _ := json.Marshal(WatchingEvent{Type: "watching", RoomID: room.ID, Mode: frame.Mode})
+				hub.Deliver(ctx, supervisor, ack)
+				if joined {
+					pipeline.History(room, supervisor, "")
+				}
+			case "leave":
+				hub.RemoveParticipant(room, supervisor)
+			case "history":
+				pipeline.History(room, supervisor, "")
+			case "typing_start", "typing_stop":
+				if _, ok := hub.ParticipantMode(room, supervisor); ok {
+					relayTyping(ctx, hub, room, supervisor, frame.Type)
+				}
+			case "delivered", "read":
+				if _, ok := hub.ParticipantMode(room, supervisor); !ok {
+					sendError(ctx, hub, supervisor, ErrorResponse{Code: CodeForbidden, RoomID: room.ID, Ref: frame.Ref, Message: "watch the room first"})
+					continue
+				}
+				acknowledge(ctx, hub, room, supervisor, frame.ID, ReceiptStatus(frame.Type), frame.Ref)
+			case "message":
+				if _, ok := hub.ParticipantMode(room, supervisor); !ok {
+					sendError(ctx, hub, supervisor, ErrorResponse{Code: CodeForbidden, RoomID: room.ID, Ref: frame.Ref, Message: "watch the room first"})
+					continue
+				}
+				relayMessage(ctx, hub, pipeline, limiter, room, supervisor, frame.Content, frame.Ref)
+			default:
+				sendError(ctx, hub, supervisor, ErrorResponse{Code: CodeInvalidPayload, RoomID: room.ID, Ref: frame.Ref, Message: "unknown frame type: " + frame.Type})
 			}
 		}
 	}
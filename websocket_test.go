@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// dialSocket opens one of hub's WebSocket endpoints (path plus query),
+// authenticating with token (signed by testAuth) in Sec-WebSocket-Protocol,
+// and returns a reader for its frames.
+func dialSocket(t *testing.T, hub *Hub, pathAndQuery string, token string) (*websocket.Conn, func() map[string]any) {
+	t.Helper()
+	return dialProtocol(t, hub, pathAndQuery, token, socketProtocol)
+}
+
+// dialProtocol is dialSocket offering subprotocol instead of the legacy one.
+func dialProtocol(t *testing.T, hub *Hub, pathAndQuery string, token string, subprotocol string) (*websocket.Conn, func() map[string]any) {
+	t.Helper()
+	translator := NewTranslator(NewFakeProvider(), NewTranslationCache(CacheOptions{TTL: time.Minute}))
+	pipeline := NewPipeline(hub, translator)
+	limiter := NewRateLimiter(100, time.Minute)
+	mux := http.NewServeMux()
+	sockets := NewSocketAuth(testAuth, hub, nil)
+	mux.HandleFunc("/ws", handleWebSocket(hub, pipeline, limiter, sockets))
+	mux.HandleFunc("/agent-ws", handleAgentWebSocket(hub, pipeline, limiter, sockets))
+	mux.HandleFunc("/supervisor-ws", handleSupervisorWebSocket(hub, pipeline, limiter, sockets))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+pathAndQuery, &websocket.DialOptions{
+		Subprotocols: []string{subprotocol, authProtocolPrefix + token},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+
+	read := func() map[string]any {
+		t.Helper()
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var frame map[string]any
+		json.Unmarshal(data, &frame)
+		return frame
+	}
+	return conn, read
+}
+
+// dialAgent opens agent's /agent-ws and waits for them to be available.
+func dialAgent(t *testing.T, hub *Hub, agent *Client) (*websocket.Conn, func() map[string]any) {
+	t.Helper()
+	agent.Role = RoleAgent
+	conn, read := dialSocket(t, hub, "/agent-ws", signedToken(t, agent))
+	waitFor(t, "agent available", func() bool { return hub.IsAvailable(agent.Token) })
+	return conn, read
+}
+
+func TestAgentSocketMultiplexesRooms(t *testing.T) {
+	hub := newTestHub(t)
+	agent := NewClient("Bob", "en")
+	agent.MaxRooms = 2
+	hub.AddClient(agent)
+	conn, read := dialAgent(t, hub, agent)
+	ctx := context.Background()
+
+	alice := NewClient("Alice", "pt")
+	carol := NewClient("Carol", "fr")
+	hub.AddClient(alice)
+	hub.AddClient(carol)
+	first := hub.CreateRoom(alice, "")
+	second := hub.CreateRoom(carol, "")
+	hub.AddMessage(second, ChatMessage{Type: "message", RoomID: second.ID, From: "Carol", SenderID: carol.ID(), Content: "Bonjour"})
+
+	for _, want := range []string{first.ID, second.ID} {
+		if frame := read(); frame["type"] != "assigned" || frame["room_id"] != want {
+			t.Fatalf("expected assigned event for %s, got %v", want, frame)
+		}
+	}
+
+	conn.Write(ctx, websocket.MessageText, []byte(`{"type":"history","room_id":"`+second.ID+`"}`))
+	if frame := read(); frame["room_id"] != second.ID || frame["translated_content"] != "[en] Bonjour" {
+		t.Errorf("expected Carol's history tagged with her room, got %v", frame)
+	}
+
+	conn.Write(ctx, websocket.MessageText, []byte(`{"room_id":"room_unknown","content":"hi"}`))
+	if frame := read(); frame["type"] != "error" {
+		t.Errorf("expected error for a room the agent isn't in, got %v", frame)
+	}
+}
+
+func TestTransferredAgentGetsTranslatedHistory(t *testing.T) {
+	hub := newTestHub(t)
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	hub.AddMessage(room, ChatMessage{Type: "message", RoomID: room.ID, From: "Alice", Content: "Olá", Language: "pt"})
+	hub.AddMessage(room, ChatMessage{Type: "message", RoomID: room.ID, From: "Bob", Content: "Hello", Language: "en"})
+
+	dave := NewClient("Dave", "es")
+	hub.AddClient(dave)
+	conn, read := dialAgent(t, hub, dave)
+	if err := hub.TransferRoom(room, bob, dave, "", "refund"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if frame := read(); frame["type"] != "assigned" || frame["note"] != "refund" || frame["transferred_from"] != "Bob" {
+		t.Fatalf("expected assigned event with Bob's note, got %v", frame)
+	}
+
+	conn.Write(context.Background(), websocket.MessageText, []byte(`{"type":"history","room_id":"`+room.ID+`"}`))
+	for _, want := range []string{"[es] Olá", "[es] Hello"} {
+		if frame := read(); frame["translated_content"] != want {
+			t.Errorf("expected %q, got %v", want, frame)
+		}
+	}
+}
+
+func TestHistoryFindsSenderByID(t *testing.T) {
+	hub := newTestHub(t)
+	translator := NewTranslator(NewFakeProvider(), NewTranslationCache(CacheOptions{TTL: time.Minute}))
+	bob := NewClient("Bob", "en")
+	room := assignedTo(t, hub, bob)
+	// Recorded before messages carried a language, and before Bob's name
+	// changed.
+	hub.AddMessage(room, ChatMessage{Type: "message", RoomID: room.ID, From: "Bobby", SenderID: bob.ID(), Content: "How can I help?"})
+
+	frames := captureFrames(t, hub, room.Customer)
+	sendHistory(context.Background(), hub, translator, room, hub.Party(room.Customer), hub.History(room), "")
+	if msg := receive(t, frames); msg.Content != "[pt] How can I help?" || msg.From != "Bobby" || msg.SenderID != bob.ID() {
+		t.Errorf("expected Bob's message translated from English, got %+v", msg)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+const (
+	// socketProtocol is the legacy, unversioned subprotocol of bare JSON
+	// frames; see protocolV1 for the enveloped one. Clients that
+	// authenticate through Sec-WebSocket-Protocol offer one of them
+	// alongside "auth.<token>" so the browser has a protocol to agree on.
+	socketProtocol     = "chat"
+	authProtocolPrefix = "auth."
+	// socketAuthTimeout is how long a socket that connected without a
+	// credential has to send its auth frame.
+	socketAuthTimeout = 10 * time.Second
+)
+
+// SocketAuth authenticates WebSocket upgrades and holds the accept options
+// every socket endpoint shares. Browsers can't set an Authorization header
+// on a WebSocket, so a credential can also come from:
+//
+//   - ?ticket=, a single-use ticket from POST /ws-ticket that expires in
+//     seconds, so it's harmless in access logs
+//   - Sec-WebSocket-Protocol, as "auth.<token or ticket>"
+//   - a {"type":"auth","token":...} first frame
+type SocketAuth struct {
+	auth   *Authenticator
+	hub    *Hub
+	accept *websocket.AcceptOptions
+}
+
+// NewSocketAuth accepts sockets from the server's own origin and from any
+// origin matching allowedOrigins (host patterns such as
+// "app.example.com" or "*.example.com").
+func NewSocketAuth(auth *Authenticator, hub *Hub, allowedOrigins []string) *SocketAuth {
+	return &SocketAuth{
+		auth: auth,
+		hub:  hub,
+		accept: &websocket.AcceptOptions{
+			Subprotocols:   []string{protocolV1, socketProtocol},
+			OriginPatterns: allowedOrigins,
+		},
+	}
+}
+
+// handshakeCredential returns the credential sent with the upgrade
+// request, if any.
+func handshakeCredential(r *http.Request) string {
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		return ticket
+	}
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			if credential, ok := strings.CutPrefix(strings.TrimSpace(protocol), authProtocolPrefix); ok {
+				return credential
+			}
+		}
+	}
+	return bearerToken(r)
+}
+
+// Accept upgrades r once the caller has authenticated with a role of at
+// least minRole. A bad handshake credential gets an HTTP error; a bad or
+// missing auth frame closes the socket with StatusPolicyViolation.
+func (s *SocketAuth) Accept(w http.ResponseWriter, r *http.Request, minRole Role) (*websocket.Conn, *Client, Claims, bool) {
+	var client *Client
+	var claims Claims
+	if credential := handshakeCredential(r); credential != "" {
+		var err error
+		client, claims, err = s.auth.authenticate(s.hub, credential, minRole, true)
+		if err != nil {
+			http.Error(w, err.Error(), authStatus(err))
+			return nil, nil, claims, false
+		}
+	}
+
+	conn, err := websocket.Accept(w, r, s.accept)
+	if err != nil {
+		slog.Error("websocket accept error", "error", err)
+		return nil, nil, claims, false
+	}
+	if client != nil {
+		return conn, client, claims, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), socketAuthTimeout)
+	defer cancel()
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		conn.Close(websocket.StatusPolicyViolation, "authentication required")
+		return nil, nil, claims, false
+	}
+	frame, err := decodeAuthFrame(conn.Subprotocol(), data)
+	if err != nil || frame.Type != "auth" {
+		conn.Close(websocket.StatusPolicyViolation, "authentication required")
+		return nil, nil, claims, false
+	}
+	client, claims, err = s.auth.authenticate(s.hub, frame.Token, minRole, true)
+	if err != nil {
+		conn.Close(websocket.StatusPolicyViolation, err.Error())
+		return nil, nil, claims, false
+	}
+	ack, _ := json.Marshal(AuthFrame{Type: "authenticated"})
+	writeFrame(ctx, conn, ack)
+	return conn, client, claims, true
+}
+
+// decodeAuthFrame parses an auth frame, enveloped on chat.v1.
+func decodeAuthFrame(protocol string, data []byte) (AuthFrame, error) {
+	var frame AuthFrame
+	if protocol != protocolV1 {
+		err := json.Unmarshal(data, &frame)
+		return frame, err
+	}
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return frame, err
+	}
+	if env.V != protocolVersion {
+		return frame, fmt.Errorf("unsupported protocol version %d", env.V)
+	}
+	err := json.Unmarshal(env.Payload, &frame)
+	frame.Type = env.Type
+	return frame, err
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// agentSocketURL serves /agent-ws for hub, accepting allowedOrigins, and
+// returns its ws:// URL.
+func agentSocketURL(t *testing.T, hub *Hub, allowedOrigins []string) string {
+	t.Helper()
+	translator := NewTranslator(NewFakeProvider(), NewTranslationCache(CacheOptions{TTL: time.Minute}))
+	sockets := NewSocketAuth(testAuth, hub, allowedOrigins)
+	srv := httptest.NewServer(handleAgentWebSocket(hub, NewPipeline(hub, translator), NewRateLimiter(100, time.Minute), sockets))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func newTestAgent(hub *Hub) *Client {
+	agent := NewClient("Bob", "en")
+	agent.Role = RoleAgent
+	hub.AddClient(agent)
+	return agent
+}
+
+func TestConnectTicketIsSingleUse(t *testing.T) {
+	hub := newTestHub(t)
+	agent := newTestAgent(hub)
+	url := agentSocketURL(t, hub, nil)
+	claims, _ := testAuth.Verify(signedToken(t, agent))
+	ticket, _, err := testAuth.IssueTicket(agent, claims)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, url+"?ticket="+ticket, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.CloseNow()
+	waitFor(t, "agent online", func() bool { return hub.IsAvailable(agent.Token) })
+
+	_, resp, err := websocket.Dial(ctx, url+"?ticket="+ticket, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected reused ticket to get 401, got %v", err)
+	}
+
+	// Tickets open sockets only; they aren't bearer tokens.
+	other, _, _ := testAuth.IssueTicket(agent, claims)
+	req := httptest.NewRequest(http.MethodGet, "/rooms", nil)
+	req.Header.Set("Authorization", "Bearer "+other)
+	rec := httptest.NewRecorder()
+	testAuth.Require(hub, RoleAgent, handleRooms(hub))(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected ticket to be refused as a bearer token, got %d", rec.Code)
+	}
+}
+
+func TestSocketFirstFrameAuth(t *testing.T) {
+	hub := newTestHub(t)
+	agent := newTestAgent(hub)
+	url := agentSocketURL(t, hub, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.CloseNow()
+	frame, _ := json.Marshal(AuthFrame{Type: "auth", Token: signedToken(t, agent)})
+	conn.Write(ctx, websocket.MessageText, frame)
+	_, data, err := conn.Read(ctx)
+	if err != nil || !strings.Contains(string(data), `"authenticated"`) {
+		t.Fatalf("expected authenticated frame, got %s (%v)", data, err)
+	}
+	waitFor(t, "agent online", func() bool { return hub.IsAvailable(agent.Token) })
+
+	bad, _, err := websocket.Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bad.CloseNow()
+	bad.Write(ctx, websocket.MessageText, []byte(`{"type":"message","content":"hi"}`))
+	if _, _, err := bad.Read(ctx); websocket.CloseStatus(err) != websocket.StatusPolicyViolation {
+		t.Errorf("expected unauthenticated socket to be closed, got %v", err)
+	}
+}
+
+func TestSocketOriginCheck(t *testing.T) {
+	hub := newTestHub(t)
+	agent := newTestAgent(hub)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dial := func(url string, origin string) (*http.Response, error) {
+		conn, resp, err := websocket.Dial(ctx, url, &websocket.DialOptions{
+			HTTPHeader:   http.Header{"Origin": {origin}},
+			Subprotocols: []string{socketProtocol, authProtocolPrefix + signedToken(t, agent)},
+		})
+		if err == nil {
+			conn.CloseNow()
+		}
+		return resp, err
+	}
+
+	if resp, err := dial(agentSocketURL(t, hub, nil), "https://evil.example"); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected foreign origin to be refused, got %v", err)
+	}
+	if _, err := dial(agentSocketURL(t, hub, []string{"*.example.com"}), "https://app.example.com"); err != nil {
+		t.Errorf("expected allowed origin to connect, got %v", err)
+	}
+}